@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/anacrolix/log"
+)
+
+// 聚合client回传的更新(FedAvg)
+// 支持两种格式:
+// 1) raw: 16字节的header + 数据
+//   - 0:4   magic "FLUP"
+//   - 4:8   dtype, uint32 little endian, 0: float32, 1: float16
+//   - 8:16  num_samples, uint64 little endian
+//   - 16:   little endian的float32/float16数组
+// 2) safetensors: num_samples保存在__metadata__中
+// 请求参数中的samples优先于数据中的num_samples, 都没有时为1
+
+const rawUpdateMagic = "FLUP"
+
+const (
+	dtypeF32  = "F32"
+	dtypeF16  = "F16"
+	dtypeBF16 = "BF16"
+)
+
+type updateFormat int
+
+const (
+	formatRaw updateFormat = iota
+	formatSafetensors
+)
+
+type tensor struct {
+	Name   string
+	Dtype  string
+	Shape  []int64
+	Values []float32
+}
+
+type modelUpdate struct {
+	Format     updateFormat
+	NumSamples int64
+	Tensors    []tensor // safetensors中按data_offsets排序
+	Metadata   map[string]string
+}
+
+// 解析client回传的数据
+func parseModelUpdate(data []byte) (*modelUpdate, error) {
+	if len(data) >= 16 && string(data[:4]) == rawUpdateMagic {
+		return parseRawUpdate(data)
+	}
+	return parseSafetensors(data)
+}
+
+func parseRawUpdate(data []byte) (*modelUpdate, error) {
+	var dtype string
+	switch binary.LittleEndian.Uint32(data[4:8]) {
+	case 0:
+		dtype = dtypeF32
+	case 1:
+		dtype = dtypeF16
+	default:
+		return nil, fmt.Errorf("unknown raw dtype %d", binary.LittleEndian.Uint32(data[4:8]))
+	}
+	values, err := decodeValues(dtype, data[16:])
+	if err != nil {
+		return nil, err
+	}
+	return &modelUpdate{
+		Format:     formatRaw,
+		NumSamples: int64(binary.LittleEndian.Uint64(data[8:16])),
+		Tensors: []tensor{{
+			Dtype:  dtype,
+			Shape:  []int64{int64(len(values))},
+			Values: values,
+		}},
+	}, nil
+}
+
+type safetensorsEntry struct {
+	Dtype       string   `json:"dtype"`
+	Shape       []int64  `json:"shape"`
+	DataOffsets [2]int64 `json:"data_offsets"`
+}
+
+// 解析safetensors的header
+// 返回header中的tensor(按data_offsets排序), metadata, 以及数据部分的起始位置
+func parseSafetensorsHeader(data []byte) (names []string, entries map[string]safetensorsEntry, metadata map[string]string, dataStart int64, err error) {
+	if len(data) < 8 {
+		return nil, nil, nil, 0, fmt.Errorf("safetensors too short: %d bytes", len(data))
+	}
+	headerLen := binary.LittleEndian.Uint64(data[:8])
+	if headerLen > uint64(len(data)-8) {
+		return nil, nil, nil, 0, fmt.Errorf("safetensors header length %d out of range", headerLen)
+	}
+	var header map[string]json.RawMessage
+	err = json.Unmarshal(data[8:8+headerLen], &header)
+	if err != nil {
+		return nil, nil, nil, 0, fmt.Errorf("safetensors header: %w", err)
+	}
+	entries = make(map[string]safetensorsEntry)
+	for name, raw := range header {
+		if name == "__metadata__" {
+			err = json.Unmarshal(raw, &metadata)
+			if err != nil {
+				return nil, nil, nil, 0, fmt.Errorf("safetensors metadata: %w", err)
+			}
+			continue
+		}
+		var e safetensorsEntry
+		err = json.Unmarshal(raw, &e)
+		if err != nil {
+			return nil, nil, nil, 0, fmt.Errorf("safetensors tensor %s: %w", name, err)
+		}
+		// 偏移相对于数据部分, 不能为负数或超出数据, 否则切片时panic
+		if e.DataOffsets[0] < 0 || e.DataOffsets[0] > e.DataOffsets[1] || e.DataOffsets[1] > int64(len(data))-8-int64(headerLen) {
+			return nil, nil, nil, 0, fmt.Errorf("safetensors tensor %s data offsets %v out of range", name, e.DataOffsets)
+		}
+		entries[name] = e
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return entries[names[i]].DataOffsets[0] < entries[names[j]].DataOffsets[0]
+	})
+	return names, entries, metadata, int64(8 + headerLen), nil
+}
+
+func parseSafetensors(data []byte) (*modelUpdate, error) {
+	names, entries, metadata, dataStart, err := parseSafetensorsHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	u := &modelUpdate{
+		Format:   formatSafetensors,
+		Metadata: metadata,
+	}
+	for _, name := range names {
+		// 按tensor对齐时插入的填充
+		if strings.HasPrefix(name, safetensorsPadPrefix) {
+			continue
+		}
+		e := entries[name]
+		begin, end := dataStart+e.DataOffsets[0], dataStart+e.DataOffsets[1]
+		if begin > end || end > int64(len(data)) {
+			return nil, fmt.Errorf("safetensors tensor %s data offsets %v out of range", name, e.DataOffsets)
+		}
+		values, err := decodeValues(e.Dtype, data[begin:end])
+		if err != nil {
+			return nil, fmt.Errorf("safetensors tensor %s: %w", name, err)
+		}
+		u.Tensors = append(u.Tensors, tensor{
+			Name:   name,
+			Dtype:  e.Dtype,
+			Shape:  e.Shape,
+			Values: values,
+		})
+	}
+	if s, ok := metadata["num_samples"]; ok {
+		u.NumSamples, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("safetensors num_samples %q: %w", s, err)
+		}
+	}
+	return u, nil
+}
+
+// 解析回传给当前轮次的更新, 没有开启聚合时返回nil
+// samples为请求参数中的样本数, 优先于数据中的num_samples
+func parseRoundUpdate(data []byte, samples string) (*modelUpdate, error) {
+	if !optionsStruct.Aggregate.Enabled {
+		return nil, nil
+	}
+	u, err := parseModelUpdate(data)
+	if err != nil {
+		return nil, err
+	}
+	if samples != "" {
+		u.NumSamples, err = strconv.ParseInt(samples, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid samples %q", samples)
+		}
+	}
+	if u.NumSamples == 0 {
+		u.NumSamples = 1
+	}
+	return u, nil
+}
+
+// 按样本数加权平均
+// 所有更新的格式、tensor名称和形状必须一致, 输出的dtype与第一个更新相同
+func fedAvg(updates []*modelUpdate) (*modelUpdate, error) {
+	if len(updates) == 0 {
+		return nil, fmt.Errorf("no update to aggregate")
+	}
+	first := updates[0]
+	var totalSamples int64
+	for i, u := range updates {
+		if u.Format != first.Format || len(u.Tensors) != len(first.Tensors) {
+			return nil, fmt.Errorf("update %d does not match the layout of update 0", i)
+		}
+		for j, t := range u.Tensors {
+			ft := first.Tensors[j]
+			if t.Name != ft.Name || len(t.Values) != len(ft.Values) {
+				return nil, fmt.Errorf("update %d tensor %q does not match tensor %q of update 0", i, t.Name, ft.Name)
+			}
+		}
+		if u.NumSamples <= 0 {
+			return nil, fmt.Errorf("update %d has %d samples", i, u.NumSamples)
+		}
+		totalSamples += u.NumSamples
+	}
+
+	ret := &modelUpdate{
+		Format:     first.Format,
+		NumSamples: totalSamples,
+		Metadata:   make(map[string]string),
+	}
+	for k, v := range first.Metadata {
+		ret.Metadata[k] = v
+	}
+	ret.Metadata["num_samples"] = strconv.FormatInt(totalSamples, 10)
+	for j, ft := range first.Tensors {
+		sum := make([]float64, len(ft.Values))
+		for _, u := range updates {
+			weight := float64(u.NumSamples) / float64(totalSamples)
+			for k, v := range u.Tensors[j].Values {
+				sum[k] += weight * float64(v)
+			}
+		}
+		values := make([]float32, len(sum))
+		for k, v := range sum {
+			values[k] = float32(v)
+		}
+		ret.Tensors = append(ret.Tensors, tensor{
+			Name:   ft.Name,
+			Dtype:  ft.Dtype,
+			Shape:  ft.Shape,
+			Values: values,
+		})
+	}
+	return ret, nil
+}
+
+// 按原来的格式编码
+func (u *modelUpdate) encode() ([]byte, error) {
+	if u.Format == formatRaw {
+		t := u.Tensors[0]
+		var dtype uint32
+		if t.Dtype == dtypeF16 {
+			dtype = 1
+		}
+		header := make([]byte, 16)
+		copy(header, rawUpdateMagic)
+		binary.LittleEndian.PutUint32(header[4:8], dtype)
+		binary.LittleEndian.PutUint64(header[8:16], uint64(u.NumSamples))
+		values, err := encodeValues(t.Dtype, t.Values)
+		if err != nil {
+			return nil, err
+		}
+		return append(header, values...), nil
+	}
+
+	header := make(map[string]interface{})
+	var body bytes.Buffer
+	for _, t := range u.Tensors {
+		values, err := encodeValues(t.Dtype, t.Values)
+		if err != nil {
+			return nil, fmt.Errorf("tensor %s: %w", t.Name, err)
+		}
+		begin := int64(body.Len())
+		body.Write(values)
+		header[t.Name] = safetensorsEntry{
+			Dtype:       t.Dtype,
+			Shape:       t.Shape,
+			DataOffsets: [2]int64{begin, int64(body.Len())},
+		}
+	}
+	if len(u.Metadata) > 0 {
+		header["__metadata__"] = u.Metadata
+	}
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	// header按8字节对齐, 用空格填充
+	for len(headerBytes)%8 != 0 {
+		headerBytes = append(headerBytes, ' ')
+	}
+	ret := make([]byte, 8, 8+len(headerBytes)+body.Len())
+	binary.LittleEndian.PutUint64(ret, uint64(len(headerBytes)))
+	ret = append(ret, headerBytes...)
+	return append(ret, body.Bytes()...), nil
+}
+
+func dtypeSize(dtype string) (int, error) {
+	switch dtype {
+	case dtypeF32:
+		return 4, nil
+	case dtypeF16, dtypeBF16:
+		return 2, nil
+	}
+	return 0, fmt.Errorf("unsupported dtype %q", dtype)
+}
+
+func decodeValues(dtype string, data []byte) ([]float32, error) {
+	size, err := dtypeSize(dtype)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%size != 0 {
+		return nil, fmt.Errorf("%d bytes is not a multiple of %s size %d", len(data), dtype, size)
+	}
+	values := make([]float32, len(data)/size)
+	for i := range values {
+		switch dtype {
+		case dtypeF32:
+			values[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+		case dtypeF16:
+			values[i] = float16ToFloat32(binary.LittleEndian.Uint16(data[i*2:]))
+		case dtypeBF16:
+			values[i] = math.Float32frombits(uint32(binary.LittleEndian.Uint16(data[i*2:])) << 16)
+		}
+	}
+	return values, nil
+}
+
+func encodeValues(dtype string, values []float32) ([]byte, error) {
+	size, err := dtypeSize(dtype)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, len(values)*size)
+	for i, v := range values {
+		switch dtype {
+		case dtypeF32:
+			binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(v))
+		case dtypeF16:
+			binary.LittleEndian.PutUint16(data[i*2:], float32ToFloat16(v))
+		case dtypeBF16:
+			// round to nearest even
+			bits := math.Float32bits(v)
+			bits += 0x7fff + (bits>>16)&1
+			binary.LittleEndian.PutUint16(data[i*2:], uint16(bits>>16))
+		}
+	}
+	return data, nil
+}
+
+// IEEE 754 half precision
+func float16ToFloat32(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := int32(h>>10) & 0x1f
+	mant := uint32(h) & 0x3ff
+	switch {
+	case exp == 0 && mant == 0:
+		return math.Float32frombits(sign)
+	case exp == 0:
+		// subnormal
+		exp = 1
+		for mant&0x400 == 0 {
+			mant <<= 1
+			exp--
+		}
+		mant &= 0x3ff
+	case exp == 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	}
+	return math.Float32frombits(sign | uint32(exp+112)<<23 | mant<<13)
+}
+
+func float32ToFloat16(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int32(bits>>23) & 0xff
+	mant := bits & 0x7fffff
+	if exp == 0xff {
+		if mant != 0 {
+			return sign | 0x7e00 // NaN
+		}
+		return sign | 0x7c00 // Inf
+	}
+	exp = exp - 127 + 15
+	if exp >= 0x1f {
+		return sign | 0x7c00
+	}
+	if exp <= 0 {
+		if exp < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint32(14 - exp)
+		half := uint16(mant >> shift)
+		// round to nearest even
+		rem := mant & (1<<shift - 1)
+		if rem > 1<<(shift-1) || (rem == 1<<(shift-1) && half&1 == 1) {
+			half++
+		}
+		return sign | half
+	}
+	half := uint16(exp)<<10 | uint16(mant>>13)
+	rem := mant & 0x1fff
+	if rem > 0x1000 || (rem == 0x1000 && half&1 == 1) {
+		half++
+	}
+	return sign | half
+}
+
+// 聚合一轮中收到的更新, 结果作为下一次handleSend分发的模型
+// 配置了上一级server时, 结果回传给上一级
+func aggregateRound(number int, updates []*modelUpdate) (int64, error) {
+	avg, err := fedAvg(updates)
+	if err != nil {
+		return 0, err
+	}
+	newData, err := avg.encode()
+	if err != nil {
+		return 0, err
+	}
+
+	// 多级聚合: 部分聚合的结果回传给上一级, 下一轮的模型从上一级获取
+	if hasParent() {
+		err = forwardToParent(newData, avg.NumSamples)
+		if err != nil {
+			return 0, fmt.Errorf("forward to parent: %w", err)
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		invalidateCurrentModelLocked()
+		log.Printf("round %d forwarded %d updates, %d samples, %d bytes to parent", number, len(updates), avg.NumSamples, len(newData))
+		return avg.NumSamples, nil
+	}
+
+	// 先写临时文件再重命名, 避免正在做种的文件只写了一半
+	if storageMethod != "memory" {
+		err = writeModelParam(modelParamPath(), newData)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	// 下一次send时重新制作torrent, 登记为新的版本
+	invalidateCurrentModelLocked()
+	data = newData
+	log.Printf("round %d aggregated %d updates, %d samples, %d bytes", number, len(updates), avg.NumSamples, len(newData))
+	return avg.NumSamples, nil
+}
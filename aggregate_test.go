@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// 按header和数据部分拼接safetensors
+func testSafetensors(header string, body []byte) []byte {
+	data := make([]byte, 8, 8+len(header)+len(body))
+	binary.LittleEndian.PutUint64(data, uint64(len(header)))
+	data = append(data, header...)
+	return append(data, body...)
+}
+
+func TestParseSafetensors(t *testing.T) {
+	body := make([]byte, 16) // 4个F32
+	tests := []struct {
+		name    string
+		data    []byte
+		err     string
+		tensors []string
+	}{
+		{
+			name:    "ok",
+			data:    testSafetensors(`{"w":{"dtype":"F32","shape":[2],"data_offsets":[0,8]},"b":{"dtype":"F32","shape":[2],"data_offsets":[8,16]}}`, body),
+			tensors: []string{"w", "b"},
+		},
+		{
+			name:    "padding",
+			data:    testSafetensors(`{"w":{"dtype":"F32","shape":[1],"data_offsets":[0,4]},"__pad_0__":{"dtype":"U8","shape":[4],"data_offsets":[4,8]},"b":{"dtype":"F32","shape":[2],"data_offsets":[8,16]}}`, body),
+			tensors: []string{"w", "b"},
+		},
+		{
+			name: "negative begin",
+			data: testSafetensors(`{"w":{"dtype":"F32","shape":[2],"data_offsets":[-8,0]}}`, body),
+			err:  "out of range",
+		},
+		{
+			name: "begin after end",
+			data: testSafetensors(`{"w":{"dtype":"F32","shape":[1],"data_offsets":[8,4]}}`, body),
+			err:  "out of range",
+		},
+		{
+			name: "end past data",
+			data: testSafetensors(`{"w":{"dtype":"F32","shape":[5],"data_offsets":[0,20]}}`, body),
+			err:  "out of range",
+		},
+		{
+			name: "end overflow",
+			data: testSafetensors(`{"w":{"dtype":"F32","shape":[1],"data_offsets":[0,9223372036854775807]}}`, body),
+			err:  "out of range",
+		},
+		{
+			name: "too short",
+			data: []byte{1, 2, 3},
+			err:  "too short",
+		},
+		{
+			name: "truncated header",
+			data: testSafetensors(`{"w":{"dtype":"F32","shape":[2],"data_offsets":[0,8]}}`, nil)[:20],
+			err:  "header length",
+		},
+		{
+			name: "bad header json",
+			data: testSafetensors(`{"w":`, body),
+			err:  "safetensors header",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := parseSafetensors(tt.data)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, tensor := range u.Tensors {
+				names = append(names, tensor.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.tensors, ",") {
+				t.Errorf("tensors %v, want %v", names, tt.tensors)
+			}
+		})
+	}
+}
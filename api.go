@@ -0,0 +1,634 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// 版本化的REST API
+// /v1/下按资源组织路由, 使用对应的http方法和状态码, 旧的接口保持不变
+// 出错时统一返回json: {"error": {"code": "torrent_not_found", "message": "...", "infohash": "..."}}
+// code是固定的字符串, client根据code判断出错的原因, message只用于显示
+// 开启Auth时GET需要read权限, 其它方法需要路由的权限(apiRoute.perm), 没有身份时返回401, 没有权限时返回403
+//
+// - torrents
+//   - GET    /v1/torrents                          client中的所有torrent
+//   - POST   /v1/torrents                          制作torrent, 输入同create_torrent, 201
+//   - GET    /v1/torrents/{infohash}               torrent的状态
+//   - DELETE /v1/torrents/{infohash}               停止做种并卸载torrent, 204
+//   - GET    /v1/torrents/{infohash}/metainfo      torrent文件
+//   - PUT    /v1/torrents/{infohash}/seeding       开始做种, body可以为空或torrent/json(storage)
+//   - DELETE /v1/torrents/{infohash}/seeding       同DELETE /v1/torrents/{infohash}
+//   - GET    /v1/torrents/{infohash}/tensor_index  tensor layout的索引
+// - jobs
+//   - GET    /v1/jobs                              所有下载任务
+//   - POST   /v1/jobs                              开始下载, 输入同start_downloading, 202
+//   - GET    /v1/jobs/{id}?wait=<秒>               任务的状态, wait时等待任务结束或超时
+//   - DELETE /v1/jobs/{id}                         取消正在运行的任务, 删除已经结束的任务(释放memory存储方式的数据)
+// - rounds
+//   - POST   /v1/rounds                            开启下一轮, 201, 上一轮还在聚合时409
+//   - GET    /v1/rounds/{round|current}            轮次的状态
+// - models
+//   - GET    /v1/models                            所有模型版本
+//   - POST   /v1/models                            发布模型版本, 输入同publish_model, 201
+//   - GET    /v1/models/{model}                    模型的所有版本
+//   - GET    /v1/models/{model}/versions/{version} 模型版本(版本名/infohash/latest)
+//   - DELETE /v1/models/{model}/versions/{version} 删除模型版本
+//   - GET    /v1/models/{model}/versions/{version}/metainfo
+// - GET /v1/status                                metainfo缓存和内置tracker的状态
+
+const apiPrefix = "/v1/"
+
+const (
+	errCodeInvalidInput        = "invalid_input"
+	errCodeInvalidInfoHash     = "invalid_infohash"
+	errCodeInvalidStorage      = "invalid_storage"
+	errCodeNotFound            = "not_found"
+	errCodeTorrentNotFound     = "torrent_not_found"
+	errCodeJobNotFound         = "job_not_found"
+	errCodeRoundNotFound       = "round_not_found"
+	errCodeModelNotFound       = "model_not_found"
+	errCodeMethodNotAllowed    = "method_not_allowed"
+	errCodeUnauthenticated     = "unauthenticated"
+	errCodeForbidden           = "forbidden"
+	errCodeConflict            = "conflict"
+	errCodeMetainfoTimeout     = "metainfo_timeout"
+	errCodeMetainfoUnavailable = "metainfo_unavailable"
+	errCodeInternal            = "internal"
+)
+
+// apiError 带有http状态码和错误码的错误, 旧接口中只使用状态码和message
+type apiError struct {
+	status   int
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	InfoHash string `json:"infohash,omitempty"`
+}
+
+func (e *apiError) Error() string { return e.Message }
+
+func apiErrorf(status int, code string, format string, a ...interface{}) *apiError {
+	return &apiError{status: status, Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+// on 记录出错的torrent
+func (e *apiError) on(ih metainfo.Hash) *apiError {
+	e.InfoHash = ih.HexString()
+	return e
+}
+
+// 把registryError/roundError等转换为apiError
+func toAPIError(err error) *apiError {
+	var ae *apiError
+	if errors.As(err, &ae) {
+		return ae
+	}
+	var re *registryError
+	if errors.As(err, &re) {
+		return &apiError{status: re.code, Code: statusErrorCode(re.code), Message: re.msg}
+	}
+	var rde *roundError
+	if errors.As(err, &rde) {
+		return &apiError{status: rde.code, Code: statusErrorCode(rde.code), Message: rde.msg}
+	}
+	return &apiError{status: http.StatusInternalServerError, Code: errCodeInternal, Message: err.Error()}
+}
+
+func statusErrorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return errCodeInvalidInput
+	case http.StatusUnauthorized:
+		return errCodeUnauthenticated
+	case http.StatusForbidden:
+		return errCodeForbidden
+	case http.StatusNotFound:
+		return errCodeNotFound
+	case http.StatusConflict:
+		return errCodeConflict
+	}
+	return errCodeInternal
+}
+
+// 错误对应的http状态码
+func errorStatus(err error) int {
+	return toAPIError(err).status
+}
+
+type apiErrorOutput struct {
+	Error *apiError `json:"error"`
+}
+
+func writeAPIError(w http.ResponseWriter, r *http.Request, err error) {
+	e := toAPIError(err)
+	log.Printf("%s %s error %d %s: %s", r.Method, r.URL.Path, e.status, e.Code, e.Message)
+	writeAPIJson(w, e.status, apiErrorOutput{Error: e})
+}
+
+func writeAPIJson(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("json marshal error: %v", err)
+		status = http.StatusInternalServerError
+		data, _ = json.Marshal(apiErrorOutput{Error: apiErrorf(status, errCodeInternal, "json marshal: %v", err)})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func writeAPIMetaInfo(w http.ResponseWriter, status int, mip *metainfo.MetaInfo) {
+	w.Header().Set("Content-Type", "application/x-bittorrent")
+	w.Header().Set("X-Magnet-Uri", magnetURI(mip))
+	w.WriteHeader(status)
+	err := mip.Write(w)
+	if err != nil {
+		log.Printf("write torrent %s error: %v", mip.HashInfoBytes().HexString(), err)
+	}
+}
+
+// 路由
+
+type apiParams map[string]string
+
+type apiHandler func(w http.ResponseWriter, r *http.Request, params apiParams) error
+
+type apiRoute struct {
+	pattern string // 以:开头的段为参数
+	perm    string // 非GET方法需要的权限, GET方法需要read
+	methods map[string]apiHandler
+}
+
+var apiRoutes = []apiRoute{
+	{"torrents", permCreate, map[string]apiHandler{"GET": apiListTorrents, "POST": apiCreateTorrent}},
+	{"torrents/:infohash", permSeed, map[string]apiHandler{"GET": apiGetTorrent, "DELETE": apiDeleteTorrent}},
+	{"torrents/:infohash/metainfo", permRead, map[string]apiHandler{"GET": apiGetMetaInfo}},
+	{"torrents/:infohash/seeding", permSeed, map[string]apiHandler{"PUT": apiStartSeeding, "DELETE": apiDeleteTorrent}},
+	{"torrents/:infohash/tensor_index", permRead, map[string]apiHandler{"GET": apiGetTensorIndex}},
+	{"jobs", permDownload, map[string]apiHandler{"GET": apiListJobs, "POST": apiStartDownloading}},
+	{"jobs/:id", permDownload, map[string]apiHandler{"GET": apiGetJob, "DELETE": apiDeleteJob}},
+	{"rounds", permRound, map[string]apiHandler{"POST": apiOpenRound}},
+	{"rounds/:round", permRead, map[string]apiHandler{"GET": apiGetRound}},
+	{"models", permCreate, map[string]apiHandler{"GET": apiListModels, "POST": apiPublishModel}},
+	{"models/:model", permRead, map[string]apiHandler{"GET": apiGetModel}},
+	{"models/:model/versions/:version", permSeed, map[string]apiHandler{"GET": apiGetModelVersion, "DELETE": apiRetireModelVersion}},
+	{"models/:model/versions/:version/metainfo", permRead, map[string]apiHandler{"GET": apiGetModelMetaInfo}},
+	{"status", permRead, map[string]apiHandler{"GET": apiGetStatus}},
+}
+
+func (route *apiRoute) match(segments []string) (apiParams, bool) {
+	pattern := strings.Split(route.pattern, "/")
+	if len(pattern) != len(segments) {
+		return nil, false
+	}
+	params := apiParams{}
+	for i, p := range pattern {
+		if strings.HasPrefix(p, ":") {
+			params[p[1:]] = segments[i]
+		} else if p != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func (route *apiRoute) allow() string {
+	var methods []string
+	for m := range route.methods {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+func serveAPI(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/"), "/")
+	for i := range apiRoutes {
+		route := &apiRoutes[i]
+		params, ok := route.match(segments)
+		if !ok {
+			continue
+		}
+		h, ok := route.methods[r.Method]
+		if !ok {
+			w.Header().Set("Allow", route.allow())
+			writeAPIError(w, r, apiErrorf(http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "method %s not allowed", r.Method))
+			return
+		}
+		perm := route.perm
+		if r.Method == "GET" {
+			perm = permRead
+		}
+		err := authorizeRequest(w, r, perm)
+		if err == nil {
+			err = h(w, r, params)
+		}
+		if err != nil {
+			e := toAPIError(err)
+			if ih, perr := params.infoHash(); e.InfoHash == "" && perr == nil {
+				e.InfoHash = ih.HexString()
+			}
+			writeAPIError(w, r, e)
+		}
+		return
+	}
+	writeAPIError(w, r, apiErrorf(http.StatusNotFound, errCodeNotFound, "no route for %s", r.URL.Path))
+}
+
+func (params apiParams) infoHash() (metainfo.Hash, error) {
+	var ih metainfo.Hash
+	err := ih.FromHexString(params["infohash"])
+	if err != nil {
+		return ih, apiErrorf(http.StatusBadRequest, errCodeInvalidInfoHash, "invalid infohash %q: %v", params["infohash"], err)
+	}
+	return ih, nil
+}
+
+func decodeAPIJson(r *http.Request, v interface{}) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		return apiErrorf(http.StatusBadRequest, errCodeInvalidInput, "json decode: %v", err)
+	}
+	return nil
+}
+
+// torrents
+
+type apiTorrent struct {
+	InfoHash string `json:"infohash"`
+	Name     string `json:"name,omitempty"`
+	getTorrentStatusOutput
+	Length         int64  `json:"length"`
+	BytesCompleted int64  `json:"bytes_completed"`
+	Magnet         string `json:"magnet,omitempty"`
+}
+
+func apiTorrentOf(t *torrent.Torrent) apiTorrent {
+	ih := t.InfoHash()
+	out := apiTorrent{
+		InfoHash:               ih.HexString(),
+		Name:                   t.Name(),
+		getTorrentStatusOutput: torrentStatus(ih),
+	}
+	if t.Info() != nil {
+		out.Length = t.Length()
+		out.BytesCompleted = t.BytesCompleted()
+		mi := t.Metainfo()
+		out.Magnet = magnetURI(&mi)
+	}
+	return out
+}
+
+func apiListTorrents(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	torrents := []apiTorrent{}
+	for _, t := range memoryTorrents.list() {
+		torrents = append(torrents, apiTorrentOf(t))
+	}
+	for _, t := range torrentClient.Torrents() {
+		torrents = append(torrents, apiTorrentOf(t))
+	}
+	writeAPIJson(w, http.StatusOK, torrents)
+	return nil
+}
+
+type apiCreateTorrentOutput struct {
+	InfoHash string `json:"infohash"`
+	Magnet   string `json:"magnet"`
+	MetaInfo []byte `json:"metainfo"` // bencode编码的torrent, json中为base64
+}
+
+// Accept为application/x-bittorrent时直接返回torrent
+func apiCreateTorrent(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	var input createTorrentInput
+	err := decodeAPIJson(r, &input)
+	if err != nil {
+		return err
+	}
+	mip, err := createTorrent(&input)
+	if err != nil {
+		return err
+	}
+	ih := mip.HashInfoBytes()
+	w.Header().Set("Location", apiPrefix+"torrents/"+ih.HexString())
+	if strings.Contains(r.Header.Get("Accept"), "application/x-bittorrent") {
+		writeAPIMetaInfo(w, http.StatusCreated, mip)
+		return nil
+	}
+	var buf strings.Builder
+	err = mip.Write(&buf)
+	if err != nil {
+		return apiErrorf(http.StatusInternalServerError, errCodeInternal, "bencode torrent: %v", err).on(ih)
+	}
+	writeAPIJson(w, http.StatusCreated, apiCreateTorrentOutput{
+		InfoHash: ih.HexString(),
+		Magnet:   magnetURI(mip),
+		MetaInfo: []byte(buf.String()),
+	})
+	return nil
+}
+
+func apiFindTorrent(params apiParams) (*torrent.Torrent, error) {
+	ih, err := params.infoHash()
+	if err != nil {
+		return nil, err
+	}
+	t, _, ok := findTorrent(ih)
+	if !ok {
+		return nil, apiErrorf(http.StatusNotFound, errCodeTorrentNotFound, "torrent %s not found", ih.HexString()).on(ih)
+	}
+	return t, nil
+}
+
+func apiGetTorrent(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	t, err := apiFindTorrent(params)
+	if err != nil {
+		return err
+	}
+	writeAPIJson(w, http.StatusOK, apiTorrentOf(t))
+	return nil
+}
+
+func apiDeleteTorrent(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	ih, err := params.infoHash()
+	if err != nil {
+		return err
+	}
+	if !stopSeeding(ih) {
+		return apiErrorf(http.StatusNotFound, errCodeTorrentNotFound, "torrent %s not found", ih.HexString()).on(ih)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func apiGetMetaInfo(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	ih, err := params.infoHash()
+	if err != nil {
+		return err
+	}
+	mip := localMetaInfo(ih)
+	if mip == nil {
+		return apiErrorf(http.StatusNotFound, errCodeTorrentNotFound, "torrent %s not found", ih.HexString()).on(ih)
+	}
+	writeAPIMetaInfo(w, http.StatusOK, mip)
+	return nil
+}
+
+// 请求中的torrent, body中没有torrent/infohash/magnet时使用路径中的infohash
+func apiTorrentRequest(r *http.Request, ih metainfo.Hash) (*torrentRequest, error) {
+	q := r.URL.Query()
+	if q.Get("infohash") == "" && q.Get("magnet") == "" {
+		q.Set("infohash", ih.HexString())
+		r.URL.RawQuery = q.Encode()
+	}
+	req, err := readTorrentRequest(r)
+	if err != nil {
+		return nil, apiErrorf(http.StatusBadRequest, errCodeInvalidInput, "%v", err).on(ih)
+	}
+	if req.ih != ih {
+		return nil, apiErrorf(http.StatusBadRequest, errCodeInvalidInfoHash, "torrent %s in request does not match %s", req.ih.HexString(), ih.HexString()).on(ih)
+	}
+	return req, nil
+}
+
+func apiStartSeeding(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	ih, err := params.infoHash()
+	if err != nil {
+		return err
+	}
+	req, err := apiTorrentRequest(r, ih)
+	if err != nil {
+		return err
+	}
+	_, err = startSeeding(r.Context(), req)
+	if err != nil {
+		return err
+	}
+	t, _, ok := findTorrent(ih)
+	if !ok {
+		return apiErrorf(http.StatusInternalServerError, errCodeInternal, "torrent %s not added", ih.HexString()).on(ih)
+	}
+	writeAPIJson(w, http.StatusOK, apiTorrentOf(t))
+	return nil
+}
+
+func apiGetTensorIndex(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	ih, err := params.infoHash()
+	if err != nil {
+		return err
+	}
+	index, ok := getTensorIndex(ih)
+	if !ok {
+		return apiErrorf(http.StatusNotFound, errCodeNotFound, "tensor index of %s not found", ih.HexString()).on(ih)
+	}
+	writeAPIJson(w, http.StatusOK, index)
+	return nil
+}
+
+// jobs
+
+func apiListJobs(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	jobs := downloadJobs.list()
+	statuses := make([]downloadJobStatus, 0, len(jobs))
+	for _, j := range jobs {
+		status := j.Status()
+		status.Output = nil
+		statuses = append(statuses, status)
+	}
+	writeAPIJson(w, http.StatusOK, statuses)
+	return nil
+}
+
+func apiStartDownloading(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	req, err := readTorrentRequest(r)
+	if err != nil {
+		return apiErrorf(http.StatusBadRequest, errCodeInvalidInput, "%v", err)
+	}
+	output, err := startDownloading(r.Context(), req)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", apiPrefix+"jobs/"+output.JobID)
+	writeAPIJson(w, http.StatusAccepted, output)
+	return nil
+}
+
+func apiFindJob(params apiParams) (*downloadJob, error) {
+	j, ok := downloadJobs.get(params["id"])
+	if !ok {
+		return nil, apiErrorf(http.StatusNotFound, errCodeJobNotFound, "job %q not found", params["id"])
+	}
+	return j, nil
+}
+
+func apiGetJob(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	j, err := apiFindJob(params)
+	if err != nil {
+		return err
+	}
+	if s := r.URL.Query().Get("wait"); s != "" {
+		seconds, err := strconv.ParseFloat(s, 64)
+		if err != nil || seconds < 0 {
+			return apiErrorf(http.StatusBadRequest, errCodeInvalidInput, "invalid wait %q", s)
+		}
+		timer := time.NewTimer(time.Duration(seconds * float64(time.Second)))
+		defer timer.Stop()
+		select {
+		case <-j.done:
+		case <-timer.C:
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+	writeAPIJson(w, http.StatusOK, j.Status())
+	return nil
+}
+
+func apiDeleteJob(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	j, err := apiFindJob(params)
+	if err != nil {
+		return err
+	}
+	writeAPIJson(w, http.StatusOK, downloadJobs.delete(j))
+	return nil
+}
+
+// rounds
+
+func writeAPIRawJson(w http.ResponseWriter, status int, data []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func apiOpenRound(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	var input openRoundInput
+	if r.ContentLength != 0 {
+		err := decodeAPIJson(r, &input)
+		if err != nil {
+			return err
+		}
+	}
+	data, err := openRound(input)
+	if err != nil {
+		return err
+	}
+	writeAPIRawJson(w, http.StatusCreated, data)
+	return nil
+}
+
+func apiGetRound(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	number := 0
+	if s := params["round"]; s != "current" {
+		var err error
+		number, err = strconv.Atoi(s)
+		if err != nil || number <= 0 {
+			return apiErrorf(http.StatusBadRequest, errCodeInvalidInput, "invalid round %q", s)
+		}
+	}
+	data, ok := rounds.status(number)
+	if !ok {
+		return apiErrorf(http.StatusNotFound, errCodeRoundNotFound, "round %s not found", params["round"])
+	}
+	writeAPIRawJson(w, http.StatusOK, data)
+	return nil
+}
+
+// models
+
+func apiListModels(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	writeAPIJson(w, http.StatusOK, registry.list(""))
+	return nil
+}
+
+func apiPublishModel(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	var input publishModelInput
+	err := decodeAPIJson(r, &input)
+	if err != nil {
+		return err
+	}
+	v, err := publishModel(&input)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", apiPrefix+"models/"+v.Model+"/versions/"+v.Version)
+	writeAPIJson(w, http.StatusCreated, v)
+	return nil
+}
+
+func apiGetModel(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	versions := registry.list(params["model"])[params["model"]]
+	if len(versions) == 0 {
+		return apiErrorf(http.StatusNotFound, errCodeModelNotFound, "model %s not found", params["model"])
+	}
+	writeAPIJson(w, http.StatusOK, versions)
+	return nil
+}
+
+func apiFindModelVersion(params apiParams) (*modelVersion, error) {
+	v, ok := registry.lookup(params["model"], params["version"])
+	if !ok {
+		return nil, apiErrorf(http.StatusNotFound, errCodeModelNotFound, "model %s version %s not found", params["model"], params["version"])
+	}
+	return v, nil
+}
+
+func apiGetModelVersion(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	v, err := apiFindModelVersion(params)
+	if err != nil {
+		return err
+	}
+	writeAPIJson(w, http.StatusOK, v)
+	return nil
+}
+
+func apiGetModelMetaInfo(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	v, err := apiFindModelVersion(params)
+	if err != nil {
+		return err
+	}
+	writeAPIMetaInfo(w, http.StatusOK, v.mi)
+	return nil
+}
+
+func apiRetireModelVersion(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	v, err := apiFindModelVersion(params)
+	if err != nil {
+		return err
+	}
+	retired := retireModel(v.Model, v.Version, 0)
+	if len(retired) == 0 {
+		return apiErrorf(http.StatusNotFound, errCodeModelNotFound, "model %s version %s not found", v.Model, v.Version)
+	}
+	writeAPIJson(w, http.StatusOK, retired)
+	return nil
+}
+
+// status
+
+type apiStatusOutput struct {
+	MetainfoCache metainfoCacheStatus `json:"metainfo_cache"`
+	Tracker       trackerStatusOutput `json:"tracker"`
+}
+
+func apiGetStatus(w http.ResponseWriter, r *http.Request, params apiParams) error {
+	output := apiStatusOutput{
+		MetainfoCache: metainfoCache.status(),
+		Tracker:       trackerStatusOutput{Swarms: []trackerSwarmStatus{}},
+	}
+	if localTracker != nil {
+		output.Tracker = localTracker.status(nil)
+	}
+	writeAPIJson(w, http.StatusOK, output)
+	return nil
+}
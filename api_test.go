@@ -0,0 +1,484 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"server/client"
+
+	"github.com/anacrolix/torrent/config"
+)
+
+// 通过server/client调用真实的http接口
+// 所有测试共用一个server进程的全局状态: tmpfs存储方法, 一个client参与轮次
+
+const testModelName = "model.bin"
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	dir, err := os.MkdirTemp("", "server-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = setupTestServer(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	code := m.Run()
+	torrentClient.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// 在dir中运行, 做种时.torrent文件写在./torrent中
+func setupTestServer(dir string) error {
+	err := os.Chdir(dir)
+	if err != nil {
+		return err
+	}
+	err = os.Mkdir("torrent", 0o750)
+	if err != nil {
+		return err
+	}
+	configStruct = &config.Config{}
+	configStruct.Client.TotalPeers = 1
+	configStruct.Model.ModelPath = filepath.Join(dir, "model")
+	configStruct.Model.ModelName = testModelName
+	configStruct.Storage.Method = "tmpfs"
+	storageMethod = "tmpfs"
+	err = os.MkdirAll(configStruct.Model.ModelPath, 0o750)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(modelParamPath(), testData(1<<20, 1), 0o644)
+	if err != nil {
+		return err
+	}
+
+	optionsFile := filepath.Join(dir, "options.jsonc")
+	err = os.WriteFile(optionsFile, []byte(`{
+		"Storage": {"DataDir": "`+filepath.Join(dir, "data")+`"},
+		"Torrent": {"Trackers": []} // 不访问外部tracker
+	}`), 0o644)
+	if err != nil {
+		return err
+	}
+	optionsStruct, err = loadOptions(optionsFile)
+	if err != nil {
+		return err
+	}
+	debug := false
+	debugFlag = &debug
+	clientConfig := newClientConfig()
+	clientConfig.SetListenAddr("127.0.0.1:0")
+	clientConfig.DisableIPv6 = true
+	err = initStorages(clientConfig)
+	if err != nil {
+		return err
+	}
+	_, err = rounds.open(openRoundInput{})
+	return err
+}
+
+func testData(n int, seed byte) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i) ^ seed
+	}
+	return data
+}
+
+func newTestClient(t *testing.T) *client.Client {
+	srv := httptest.NewServer(newServeMux())
+	t.Cleanup(srv.Close)
+	c := client.New(srv.URL)
+	c.RetryDelay = time.Millisecond
+	return c
+}
+
+func TestTorrentLifecycle(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	path := filepath.Join(configStruct.Model.ModelPath, "lifecycle.bin")
+	err := os.WriteFile(path, testData(256<<10, 2), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi, err := c.CreateTorrent(ctx, &client.CreateTorrentInput{Path: path, Storage: "tmpfs"})
+	if err != nil {
+		t.Fatalf("CreateTorrent: %v", err)
+	}
+	ih := mi.HashInfoBytes()
+
+	status, err := c.SeedTorrent(ctx, &client.TorrentRef{MetaInfo: mi, Storage: "tmpfs"})
+	if err != nil {
+		t.Fatalf("SeedTorrent: %v", err)
+	}
+	if !status.Exist || !status.Seeding || status.Storage != "tmpfs" {
+		t.Errorf("SeedTorrent status %+v", status)
+	}
+
+	status, err = c.TorrentStatus(ctx, ih)
+	if err != nil {
+		t.Fatalf("TorrentStatus: %v", err)
+	}
+	if status.InfoHash != ih.HexString() || !status.Exist || status.Length != 256<<10 {
+		t.Errorf("TorrentStatus %+v", status)
+	}
+
+	stopped, err := c.StopTorrent(ctx, ih)
+	if err != nil || !stopped {
+		t.Fatalf("StopTorrent = %v, %v", stopped, err)
+	}
+	stopped, err = c.StopTorrent(ctx, ih)
+	if err != nil || stopped {
+		t.Errorf("StopTorrent again = %v, %v", stopped, err)
+	}
+	status, err = c.TorrentStatus(ctx, ih)
+	if err == nil && status.Exist {
+		t.Errorf("torrent still exists after stop: %+v", status)
+	}
+}
+
+// tmpfs的路径必须直接位于ModelPath中
+func TestCreateTorrentOutsideModelPath(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "outside.bin")
+	err := os.WriteFile(path, testData(64<<10, 4), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CreateTorrent(ctx, &client.CreateTorrentInput{Path: path, Storage: "tmpfs"})
+	if err == nil {
+		t.Errorf("CreateTorrent outside ModelPath succeeded")
+	}
+	sub := filepath.Join(configStruct.Model.ModelPath, "sub")
+	err = os.MkdirAll(sub, 0o750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path = filepath.Join(sub, "nested.bin")
+	err = os.WriteFile(path, testData(64<<10, 5), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CreateTorrent(ctx, &client.CreateTorrentInput{Path: path, Storage: "tmpfs"})
+	if err == nil {
+		t.Errorf("CreateTorrent in a subdirectory of ModelPath succeeded")
+	}
+}
+
+func TestDownloadJob(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	path := filepath.Join(configStruct.Model.ModelPath, "job.bin")
+	err := os.WriteFile(path, testData(512<<10, 3), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi, err := c.CreateTorrent(ctx, &client.CreateTorrentInput{Path: path, Storage: "tmpfs"})
+	if err != nil {
+		t.Fatalf("CreateTorrent: %v", err)
+	}
+	ih := mi.HashInfoBytes()
+	defer c.StopTorrent(ctx, ih)
+	_, err = c.SeedTorrent(ctx, &client.TorrentRef{MetaInfo: mi, Storage: "tmpfs"})
+	if err != nil {
+		t.Fatalf("SeedTorrent: %v", err)
+	}
+
+	// 本地已经有全部数据, 任务立即完成
+	output, err := c.StartDownloading(ctx, &client.TorrentRef{InfoHash: ih, Storage: "tmpfs"})
+	if err != nil {
+		t.Fatalf("StartDownloading: %v", err)
+	}
+	if output.JobID == "" {
+		t.Fatalf("StartDownloading output %+v", output)
+	}
+	var job *client.JobStatus
+	for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); {
+		job, err = c.WaitJob(ctx, output.JobID, time.Second)
+		if err != nil {
+			t.Fatalf("WaitJob: %v", err)
+		}
+		if job.State != client.JobRunning {
+			break
+		}
+	}
+	if job.State != client.JobCompleted || job.Output == nil {
+		t.Fatalf("job %+v", job)
+	}
+	if job.InfoHash != ih.HexString() || job.BytesCompleted != 512<<10 || job.Output.Path != path {
+		t.Errorf("job %+v, output %+v", job, job.Output)
+	}
+
+	// 结束的任务可以重复查询, 删除后不存在
+	again, err := c.Job(ctx, output.JobID)
+	if err != nil || again.Output == nil || again.Output.Path != path {
+		t.Errorf("Job again = %+v, %v", again, err)
+	}
+	_, err = c.CancelJob(ctx, output.JobID)
+	if err != nil {
+		t.Errorf("CancelJob: %v", err)
+	}
+	_, err = c.Job(ctx, output.JobID)
+	if client.ErrorCode(err) != client.CodeJobNotFound {
+		t.Errorf("deleted job error %v", err)
+	}
+
+	_, err = c.Job(ctx, "no-such-job")
+	if client.ErrorCode(err) != client.CodeJobNotFound {
+		t.Errorf("unknown job error %v", err)
+	}
+	if e, ok := err.(*client.Error); !ok || e.Status != http.StatusNotFound {
+		t.Errorf("unknown job error %#v", err)
+	}
+}
+
+// 下载中的torrent被卸载时任务结束
+func TestDownloadJobTorrentDropped(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	path := filepath.Join(configStruct.Model.ModelPath, "dropped.bin")
+	err := os.WriteFile(path, testData(256<<10, 6), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi, err := c.CreateTorrent(ctx, &client.CreateTorrentInput{Path: path, Storage: "tmpfs"})
+	if err != nil {
+		t.Fatalf("CreateTorrent: %v", err)
+	}
+	// 本地没有数据也没有peer, 任务一直运行
+	err = os.Remove(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := c.StartDownloading(ctx, &client.TorrentRef{MetaInfo: mi, Storage: "tmpfs"})
+	if err != nil {
+		t.Fatalf("StartDownloading: %v", err)
+	}
+	stopped, err := c.StopTorrent(ctx, mi.HashInfoBytes())
+	if err != nil || !stopped {
+		t.Fatalf("StopTorrent = %v, %v", stopped, err)
+	}
+	job, err := c.WaitJob(ctx, output.JobID, 10*time.Second)
+	if err != nil {
+		t.Fatalf("WaitJob: %v", err)
+	}
+	if job.State != client.JobCanceled {
+		t.Errorf("job %+v", job)
+	}
+}
+
+func TestRound(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+	round, err := rounds.open(openRoundInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &client.RoundOptions{Name: "worker"}
+	mi, err := c.Send(ctx, opts)
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if len(mi.InfoBytes) == 0 {
+		t.Fatalf("Send returned empty metainfo")
+	}
+	if opts.Client == "" {
+		t.Fatalf("Send did not set the client id")
+	}
+	err = c.CompleteSend(ctx, opts)
+	if err != nil {
+		t.Fatalf("CompleteSend: %v", err)
+	}
+	opts.Samples = 10
+	err = c.Recv(ctx, []byte("update"), opts)
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+
+	// 同一个client在一轮中只能回传一次
+	err = c.Recv(ctx, []byte("update"), opts)
+	if e, ok := err.(*client.Error); !ok || e.Status != http.StatusConflict {
+		t.Errorf("second Recv error %v", err)
+	}
+
+	data, err := c.RoundStatus(ctx, round.Number)
+	if err != nil {
+		t.Fatalf("RoundStatus: %v", err)
+	}
+	var rd struct {
+		State   string `json:"state"`
+		Clients map[string]struct {
+			Sent bool `json:"sent"`
+			Recv bool `json:"recv"`
+		} `json:"clients"`
+	}
+	err = json.Unmarshal(data, &rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, ok := rd.Clients[opts.Client]
+	if !ok || !cs.Sent || !cs.Recv {
+		t.Errorf("round clients %+v", rd.Clients)
+	}
+	if rd.State != roundCompleted {
+		t.Errorf("round state %s", rd.State)
+	}
+}
+
+// 没有id也没有name的client按ip统计, 不分配id
+func TestRoundAnonymous(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+	round, err := rounds.open(openRoundInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &client.RoundOptions{}
+	for i := 0; i < 3; i++ {
+		_, err = c.Send(ctx, opts)
+		if err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	if opts.Client != "" {
+		t.Errorf("Send set the client id %q", opts.Client)
+	}
+	data, err := c.RoundStatus(ctx, round.Number)
+	if err != nil {
+		t.Fatalf("RoundStatus: %v", err)
+	}
+	var rd struct {
+		Clients map[string]json.RawMessage `json:"clients"`
+	}
+	err = json.Unmarshal(data, &rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rd.Clients["127.0.0.1"]; !ok || len(rd.Clients) != 1 {
+		t.Errorf("round clients %s", data)
+	}
+}
+
+// 回传的torrent已经在本地时返回409, 不能卸载server自己的torrent
+func TestRecvTorrentExisting(t *testing.T) {
+	srv := httptest.NewServer(newServeMux())
+	defer srv.Close()
+	c := client.New(srv.URL)
+	ctx := context.Background()
+	_, err := rounds.open(openRoundInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(configStruct.Model.ModelPath, "existing.bin")
+	err = os.WriteFile(path, testData(64<<10, 7), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi, err := c.CreateTorrent(ctx, &client.CreateTorrentInput{Path: path, Storage: "tmpfs"})
+	if err != nil {
+		t.Fatalf("CreateTorrent: %v", err)
+	}
+	ih := mi.HashInfoBytes()
+	defer c.StopTorrent(ctx, ih)
+	_, err = c.SeedTorrent(ctx, &client.TorrentRef{MetaInfo: mi, Storage: "tmpfs"})
+	if err != nil {
+		t.Fatalf("SeedTorrent: %v", err)
+	}
+
+	var body bytes.Buffer
+	err = mi.Write(&body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(srv.URL+"/recv_torrent/?name=worker", "application/x-bittorrent", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("recv_torrent status %s", resp.Status)
+	}
+	status, err := c.TorrentStatus(ctx, ih)
+	if err != nil || !status.Exist || !status.Seeding {
+		t.Errorf("torrent status after recv_torrent %+v, %v", status, err)
+	}
+}
+
+// 上一级server没有响应时超时返回, 等待期间不持有mutex
+func TestSendParentTimeout(t *testing.T) {
+	release := make(chan struct{})
+	parent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer parent.Close()
+	defer close(release)
+	_, err := rounds.open(openRoundInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	saved := mi
+	mi = nil
+	mutex.Unlock()
+	savedTimeout := optionsStruct.Hierarchy.Timeout
+	optionsStruct.Hierarchy.Parent = parent.URL
+	optionsStruct.Hierarchy.Timeout = 1
+	defer func() {
+		optionsStruct.Hierarchy.Parent = ""
+		optionsStruct.Hierarchy.Timeout = savedTimeout
+		mutex.Lock()
+		mi = saved
+		mutex.Unlock()
+	}()
+
+	srv := httptest.NewServer(newServeMux())
+	defer srv.Close()
+	done := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get(srv.URL + "/send/?name=worker")
+		if err != nil {
+			t.Error(err)
+		}
+		done <- resp
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	if !mutex.TryLock() {
+		t.Errorf("mutex is held while requesting the parent")
+	} else {
+		mutex.Unlock()
+	}
+	select {
+	case resp := <-done:
+		if resp != nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadGateway {
+				t.Errorf("send status %s", resp.Status)
+			}
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("send did not time out")
+	}
+}
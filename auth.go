@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"server/controlpb"
+
+	"github.com/anacrolix/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// 控制接口的认证和授权
+// Auth.Enabled打开后, 请求需要带上身份, 每个身份只能访问有权限的接口:
+// - bearer token: Authorization: Bearer <token>, token与身份的对应关系在Auth.Tokens中
+// - mTLS: 配置Auth.ClientCAFile后验证client证书, 身份为证书的CommonName
+// 身份的权限在Auth.Permissions中, 例如worker只有download/client/read, coordinator有*
+// 认证方式通过authenticator扩展, http和grpc共用
+// /status/、webseed和内置tracker不需要认证(BitTorrent client无法携带token)
+
+const (
+	permRead     = "read"     // 查询状态、任务、模型和轮次
+	permDownload = "download" // 开始/取消下载
+	permClient   = "client"   // send/recv等client与server之间的接口
+	permCreate   = "create"   // 制作torrent, 发布模型
+	permSeed     = "seed"     // 开始/停止做种, 删除模型版本
+	permRound    = "round"    // 开启新一轮
+	permAll      = "*"
+)
+
+var knownPermissions = map[string]bool{
+	permRead:     true,
+	permDownload: true,
+	permClient:   true,
+	permCreate:   true,
+	permSeed:     true,
+	permRound:    true,
+	permAll:      true,
+}
+
+// 请求中的凭证, http和grpc共用
+type authCredentials struct {
+	bearer string
+	certs  []*x509.Certificate // 已经验证的client证书链, 第一个为client证书
+}
+
+// authenticator 从凭证中识别身份
+// 凭证中没有对应的内容时返回"", 凭证无效时返回错误
+type authenticator interface {
+	authenticate(c *authCredentials) (string, error)
+}
+
+// 静态bearer token, token -> 身份
+type tokenAuthenticator map[string]string
+
+func (a tokenAuthenticator) authenticate(c *authCredentials) (string, error) {
+	if c.bearer == "" {
+		return "", nil
+	}
+	identity := ""
+	for token, id := range a {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(c.bearer)) == 1 {
+			identity = id
+		}
+	}
+	if identity == "" {
+		return "", errors.New("invalid bearer token")
+	}
+	return identity, nil
+}
+
+// client证书, 身份为CommonName
+type certAuthenticator struct{}
+
+func (certAuthenticator) authenticate(c *authCredentials) (string, error) {
+	if len(c.certs) == 0 {
+		return "", nil
+	}
+	if c.certs[0].Subject.CommonName == "" {
+		return "", errors.New("client certificate has no common name")
+	}
+	return c.certs[0].Subject.CommonName, nil
+}
+
+var authenticators []authenticator
+
+// http和grpc的TLS配置, 没有配置证书时为nil
+var serverTLS *tls.Config
+
+func authEnabled() bool {
+	return optionsStruct != nil && optionsStruct.Auth.Enabled
+}
+
+func checkAuth(options *serverOptions) error {
+	for identity, perms := range options.Auth.Permissions {
+		for _, p := range perms {
+			if !knownPermissions[p] {
+				return fmt.Errorf("identity %s has unknown permission %q", identity, p)
+			}
+		}
+	}
+	for _, identity := range options.Auth.Tokens {
+		if identity == "" {
+			return fmt.Errorf("auth token without identity")
+		}
+	}
+	if (options.Auth.CertFile == "") != (options.Auth.KeyFile == "") {
+		return fmt.Errorf("auth CertFile and KeyFile must be set together")
+	}
+	if options.Auth.ClientCAFile != "" && options.Auth.CertFile == "" {
+		return fmt.Errorf("auth ClientCAFile requires CertFile and KeyFile")
+	}
+	if options.Auth.Enabled && len(options.Auth.Tokens) == 0 && options.Auth.ClientCAFile == "" {
+		return fmt.Errorf("auth enabled without Tokens or ClientCAFile, no request can be authenticated")
+	}
+	return nil
+}
+
+// 加载证书, 创建authenticator
+func initAuth() error {
+	a := &optionsStruct.Auth
+	if a.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(a.CertFile, a.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load server certificate: %w", err)
+		}
+		serverTLS = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+	if a.ClientCAFile != "" {
+		data, err := os.ReadFile(a.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificate in client CA file %s", a.ClientCAFile)
+		}
+		// 没有证书的client仍然可以使用bearer token
+		serverTLS.ClientCAs = pool
+		serverTLS.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	authenticators = nil
+	if len(a.Tokens) > 0 {
+		authenticators = append(authenticators, tokenAuthenticator(a.Tokens))
+	}
+	if a.ClientCAFile != "" {
+		authenticators = append(authenticators, certAuthenticator{})
+	}
+	if a.Enabled {
+		log.Printf("auth enabled, %d tokens, client certificates %v, %d identities", len(a.Tokens), a.ClientCAFile != "", len(a.Permissions))
+	}
+	return nil
+}
+
+func hasPermission(identity, perm string) bool {
+	for _, p := range optionsStruct.Auth.Permissions[identity] {
+		if p == permAll || p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// 依次使用每种认证方式, 返回第一个得到的身份
+func authenticate(c *authCredentials) (string, error) {
+	for _, a := range authenticators {
+		id, err := a.authenticate(c)
+		if err != nil {
+			return "", apiErrorf(http.StatusUnauthorized, errCodeUnauthenticated, "%v", err)
+		}
+		if id != "" {
+			return id, nil
+		}
+	}
+	return "", apiErrorf(http.StatusUnauthorized, errCodeUnauthenticated, "authentication required")
+}
+
+// 识别身份并检查权限, 没有开启时允许所有请求
+func authorize(c *authCredentials, perm string) (string, error) {
+	if !authEnabled() {
+		return "", nil
+	}
+	identity, err := authenticate(c)
+	if err != nil {
+		return "", err
+	}
+	if !hasPermission(identity, perm) {
+		return identity, apiErrorf(http.StatusForbidden, errCodeForbidden, "%s does not have %s permission", identity, perm)
+	}
+	return identity, nil
+}
+
+func httpCredentials(r *http.Request) *authCredentials {
+	c := &authCredentials{}
+	if h := r.Header.Get("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		c.bearer = strings.TrimSpace(h[7:])
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		c.certs = r.TLS.VerifiedChains[0]
+	}
+	return c
+}
+
+// 检查http请求的权限, 出错时返回的error已经包含状态码
+func authorizeRequest(w http.ResponseWriter, r *http.Request, perm string) error {
+	identity, err := authorize(httpCredentials(r), perm)
+	if err != nil {
+		log.Printf("%s %s from %s denied: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+		if errorStatus(err) == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="server"`)
+		}
+		return err
+	}
+	if identity != "" {
+		log.Printf("%s %s from %s as %s", r.Method, r.URL.Path, r.RemoteAddr, identity)
+	}
+	return nil
+}
+
+// http请求的身份, 没有开启Auth或认证失败时为空
+// 权限已经由authorizeRequest检查过, 这里只用于识别请求者(比如轮次中的client)
+func requestIdentity(r *http.Request) string {
+	if !authEnabled() {
+		return ""
+	}
+	identity, _ := authenticate(httpCredentials(r))
+	return identity
+}
+
+// 旧接口的权限检查
+func requirePermission(perm string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := authorizeRequest(w, r, perm)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// grpc
+
+var grpcPermissions = map[string]string{
+	controlpb.Control_CreateTorrent_FullMethodName:    permCreate,
+	controlpb.Control_StartSeeding_FullMethodName:     permSeed,
+	controlpb.Control_StopSeeding_FullMethodName:      permSeed,
+	controlpb.Control_GetTorrentStatus_FullMethodName: permRead,
+	controlpb.Control_StartDownloading_FullMethodName: permDownload,
+	controlpb.Control_WatchDownload_FullMethodName:    permRead,
+	controlpb.Control_GetJob_FullMethodName:           permRead,
+	controlpb.Control_WaitJob_FullMethodName:          permRead,
+}
+
+func grpcCredentials(ctx context.Context) *authCredentials {
+	c := &authCredentials{}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, h := range md.Get("authorization") {
+			if len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+				c.bearer = strings.TrimSpace(h[7:])
+			}
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 {
+			c.certs = info.State.VerifiedChains[0]
+		}
+	}
+	return c
+}
+
+func grpcAuthorize(ctx context.Context, fullMethod string) error {
+	perm, ok := grpcPermissions[fullMethod]
+	if !ok {
+		perm = permAll
+	}
+	_, err := authorize(grpcCredentials(ctx), perm)
+	if err != nil {
+		log.Printf("grpc %s denied: %v", fullMethod, err)
+		return grpcError(err)
+	}
+	return nil
+}
+
+func grpcUnaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	err := grpcAuthorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func grpcStreamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	err := grpcAuthorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// metainfo缓存
+// tmpfs/disk的create_torrent(以及send)每次都要读取整个文件计算piece hash,
+// 同一个没有变化的checkpoint被反复请求时直接返回缓存的MetaInfo:
+// - key为路径和制作选项(文件列表, piece length)
+// - 记录每个文件的大小和修改时间, 任何一个变化(或文件增减)时丢弃缓存, 重新计算
+// - Torrent.CacheFingerprint打开时额外比较每个文件开头和结尾的sha1,
+//   用于修改时间不可靠的情况(比如cp -p、精度较低的文件系统)
+// - 最多缓存Torrent.CacheEntries个, 超过时淘汰最久没有使用的
+// 统计信息通过metainfo_cache_status获取
+
+const (
+	defaultCacheEntries = 64
+	fingerprintBlock    = 64 << 10
+)
+
+// 制作torrent时每个文件的状态
+type fileState struct {
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+}
+
+type metainfoCacheEntry struct {
+	path     string
+	state    []fileState
+	mi       *metainfo.MetaInfo
+	created  time.Time
+	lastUsed time.Time
+	hits     int64
+}
+
+type metainfoCacheStats struct {
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Invalidations int64 `json:"invalidations"` // 文件变化后丢弃的缓存
+	Evictions     int64 `json:"evictions"`     // 超过数量限制淘汰的缓存
+}
+
+type metainfoCacheT struct {
+	mu      sync.Mutex
+	entries map[string]*metainfoCacheEntry
+	stats   metainfoCacheStats
+}
+
+var metainfoCache = &metainfoCacheT{entries: make(map[string]*metainfoCacheEntry)}
+
+func cacheEntries() int {
+	if optionsStruct == nil || optionsStruct.Torrent.CacheEntries == 0 {
+		return defaultCacheEntries
+	}
+	return optionsStruct.Torrent.CacheEntries
+}
+
+func cacheFingerprint() bool {
+	return optionsStruct != nil && optionsStruct.Torrent.CacheFingerprint
+}
+
+func metainfoCacheKey(filePath string, opts buildOptions) string {
+	abs, err := filepath.Abs(filePath)
+	if err != nil {
+		abs = filePath
+	}
+	return fmt.Sprintf("%s|%s|%d", abs, strings.Join(opts.Files, "|"), opts.PieceLength)
+}
+
+// 获取info中每个文件的状态
+func statInfoFiles(filePath string, info *metainfo.Info) ([]fileState, error) {
+	var state []fileState
+	for _, fi := range info.UpvertedFiles() {
+		path := filepath.Join(filePath, filepath.Join(fi.Path...))
+		st, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		s := fileState{
+			Path:    path,
+			Size:    st.Size(),
+			ModTime: st.ModTime(),
+		}
+		if cacheFingerprint() {
+			s.Fingerprint, err = fileFingerprint(path, st.Size())
+			if err != nil {
+				return nil, err
+			}
+		}
+		state = append(state, s)
+	}
+	return state, nil
+}
+
+// 文件开头和结尾各fingerprintBlock字节的sha1
+func fileFingerprint(path string, size int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha1.New()
+	_, err = io.Copy(h, io.LimitReader(f, fingerprintBlock))
+	if err != nil {
+		return "", err
+	}
+	if size > fingerprintBlock {
+		off := size - fingerprintBlock
+		if off < fingerprintBlock {
+			off = fingerprintBlock
+		}
+		_, err = io.Copy(h, io.NewSectionReader(f, off, size-off))
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func sameFileState(a, b []fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Path != b[i].Path || a[i].Size != b[i].Size || !a[i].ModTime.Equal(b[i].ModTime) ||
+			a[i].Fingerprint != b[i].Fingerprint {
+			return false
+		}
+	}
+	return true
+}
+
+// 文件状态与缓存一致时返回缓存的MetaInfo(副本), 否则丢弃缓存
+func (c *metainfoCacheT) get(filePath string, opts buildOptions, state []fileState) (*metainfo.MetaInfo, bool) {
+	if cacheEntries() < 0 {
+		return nil, false
+	}
+	key := metainfoCacheKey(filePath, opts)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	if !sameFileState(e.state, state) {
+		log.Printf("metainfo cache: %s changed, drop %s", filePath, e.mi.HashInfoBytes().HexString())
+		delete(c.entries, key)
+		c.stats.Invalidations++
+		c.stats.Misses++
+		return nil, false
+	}
+	e.hits++
+	e.lastUsed = time.Now()
+	c.stats.Hits++
+	log.Printf("metainfo cache: hit %s, %s", filePath, e.mi.HashInfoBytes().HexString())
+	mi := *e.mi
+	return &mi, true
+}
+
+// 缓存MetaInfo, state是计算hash之前的文件状态
+// 计算hash期间文件被修改时不缓存, 下一次请求重新计算
+func (c *metainfoCacheT) put(filePath string, opts buildOptions, state []fileState, mip *metainfo.MetaInfo) {
+	capacity := cacheEntries()
+	if capacity < 0 {
+		return
+	}
+	info, err := mip.UnmarshalInfo()
+	if err != nil {
+		return
+	}
+	after, err := statInfoFiles(filePath, &info)
+	if err != nil || !sameFileState(state, after) {
+		log.Printf("metainfo cache: %s changed while hashing, not cached", filePath)
+		return
+	}
+	key := metainfoCacheKey(filePath, opts)
+	mi := *mip
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = &metainfoCacheEntry{
+		path:     filePath,
+		state:    state,
+		mi:       &mi,
+		created:  now,
+		lastUsed: now,
+	}
+	// 淘汰最久没有使用的
+	for len(c.entries) > capacity {
+		var oldestKey string
+		var oldest *metainfoCacheEntry
+		for k, e := range c.entries {
+			if oldest == nil || e.lastUsed.Before(oldest.lastUsed) {
+				oldestKey, oldest = k, e
+			}
+		}
+		delete(c.entries, oldestKey)
+		c.stats.Evictions++
+	}
+}
+
+type metainfoCacheItem struct {
+	Path     string      `json:"path"`
+	InfoHash string      `json:"infohash"`
+	Files    []fileState `json:"files"`
+	Created  time.Time   `json:"created"`
+	LastUsed time.Time   `json:"last_used"`
+	Hits     int64       `json:"hits"`
+}
+
+type metainfoCacheStatus struct {
+	metainfoCacheStats
+	Entries     int                 `json:"entries"`
+	Capacity    int                 `json:"capacity"` // 为负数时不缓存
+	Fingerprint bool                `json:"fingerprint"`
+	Items       []metainfoCacheItem `json:"items"`
+}
+
+func (c *metainfoCacheT) status() metainfoCacheStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ret := metainfoCacheStatus{
+		metainfoCacheStats: c.stats,
+		Entries:            len(c.entries),
+		Capacity:           cacheEntries(),
+		Fingerprint:        cacheFingerprint(),
+		Items:              []metainfoCacheItem{},
+	}
+	for _, e := range c.entries {
+		ret.Items = append(ret.Items, metainfoCacheItem{
+			Path:     e.path,
+			InfoHash: e.mi.HashInfoBytes().HexString(),
+			Files:    e.state,
+			Created:  e.created,
+			LastUsed: e.lastUsed,
+			Hits:     e.hits,
+		})
+	}
+	return ret
+}
+
+// 获取metainfo缓存的统计信息
+// - 名称：metainfo_cache_status
+// - 输入：无
+// - 方法：GET
+// - 输出：命中/未命中/失效/淘汰次数和缓存的条目(json)
+
+func metainfo_cache_status(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
+	data, err := json.Marshal(metainfoCache.status())
+	if err != nil {
+		log.Printf("metainfo_cache_status json marshal error: %v", err)
+		http.Error(w, "Json marshal cache status failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
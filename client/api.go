@@ -0,0 +1,524 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// 与server中getTorrentStatusOutput/startDownloadingOutput/downloadJobStatus等对应的类型
+
+// PieceLengthAuto 按数据大小和client数量选择piece length
+const PieceLengthAuto int64 = -1
+
+// CreateTorrentInput create_torrent的输入
+type CreateTorrentInput struct {
+	Data        []byte     // memory存储方式的数据
+	Path        string     // tmpfs/disk存储方式的文件或目录
+	Storage     string     // 为空时使用server的Storage.Method
+	Base        string     // 上一个版本的infohash, 制作delta torrent
+	Layout      string     // 为tensor时按tensor对齐safetensors文件
+	Files       []string   // path为目录时包含的文件及其顺序
+	PieceLength int64      // 字节数或PieceLengthAuto, 为0时使用server的Torrent.PieceLength
+	Trackers    [][]string // 为nil时使用server的tracker, 空的slice表示不使用tracker
+}
+
+type memoryBuf struct {
+	Data   []byte
+	Length int64
+}
+
+type createTorrentRequest struct {
+	Mb          memoryBuf   `json:"mb"`
+	Path        string      `json:"path"`
+	Storage     string      `json:"storage,omitempty"`
+	Base        string      `json:"base,omitempty"`
+	Layout      string      `json:"layout,omitempty"`
+	Files       []string    `json:"files,omitempty"`
+	PieceLength interface{} `json:"piece_length,omitempty"`
+	Trackers    [][]string  `json:"trackers"`
+}
+
+func (in *CreateTorrentInput) request() createTorrentRequest {
+	req := createTorrentRequest{
+		Mb:       memoryBuf{Data: in.Data, Length: int64(len(in.Data))},
+		Path:     in.Path,
+		Storage:  in.Storage,
+		Base:     in.Base,
+		Layout:   in.Layout,
+		Files:    in.Files,
+		Trackers: in.Trackers,
+	}
+	if in.PieceLength == PieceLengthAuto {
+		req.PieceLength = "auto"
+	} else if in.PieceLength != 0 {
+		req.PieceLength = in.PieceLength
+	}
+	return req
+}
+
+// TorrentRef 请求中的torrent: 完整的metainfo, infohash或magnet
+type TorrentRef struct {
+	MetaInfo *metainfo.MetaInfo
+	InfoHash metainfo.Hash
+	Magnet   string
+	Storage  string    // 为空时使用create_torrent时的存储方法或server的默认值
+	Files    []string  // 部分下载: torrent中的文件
+	Ranges   [][]int64 // 部分下载: 字节范围[begin, end)
+	Peers    []string  // 额外的peer, "ip"或"ip:port"
+}
+
+func (ref *TorrentRef) infoHash() (metainfo.Hash, error) {
+	if ref.MetaInfo != nil {
+		return ref.MetaInfo.HashInfoBytes(), nil
+	}
+	if ref.Magnet != "" {
+		m, err := metainfo.ParseMagnetUri(ref.Magnet)
+		if err != nil {
+			return metainfo.Hash{}, fmt.Errorf("parse magnet: %w", err)
+		}
+		return m.InfoHash, nil
+	}
+	if ref.InfoHash == (metainfo.Hash{}) {
+		return metainfo.Hash{}, fmt.Errorf("no metainfo, infohash or magnet")
+	}
+	return ref.InfoHash, nil
+}
+
+// 请求的body: bencode编码的torrent(额外的字段与MetaInfo在同一个dict中), 或者json
+func (ref *TorrentRef) body() ([]byte, string, error) {
+	if ref.MetaInfo == nil {
+		input := struct {
+			InfoHash string    `json:"infohash,omitempty"`
+			Magnet   string    `json:"magnet,omitempty"`
+			Storage  string    `json:"storage,omitempty"`
+			Files    []string  `json:"files,omitempty"`
+			Ranges   [][]int64 `json:"ranges,omitempty"`
+			Peers    []string  `json:"peers,omitempty"`
+		}{
+			Magnet:  ref.Magnet,
+			Storage: ref.Storage,
+			Files:   ref.Files,
+			Ranges:  ref.Ranges,
+			Peers:   ref.Peers,
+		}
+		if ref.Magnet == "" {
+			input.InfoHash = ref.InfoHash.HexString()
+		}
+		data, err := jsonBody(input)
+		return data, "application/json", err
+	}
+
+	data, err := bencode.Marshal(ref.MetaInfo)
+	if err != nil {
+		return nil, "", fmt.Errorf("bencode metainfo: %w", err)
+	}
+	var dict map[string]bencode.Bytes
+	err = bencode.Unmarshal(data, &dict)
+	if err != nil {
+		return nil, "", fmt.Errorf("bdecode metainfo: %w", err)
+	}
+	extra := map[string]interface{}{}
+	if ref.Storage != "" {
+		extra["storage"] = ref.Storage
+	}
+	if len(ref.Files) != 0 {
+		extra["files"] = ref.Files
+	}
+	if len(ref.Ranges) != 0 {
+		extra["ranges"] = ref.Ranges
+	}
+	if len(ref.Peers) != 0 {
+		extra["peers"] = ref.Peers
+	}
+	for k, v := range extra {
+		dict[k], err = bencode.Marshal(v)
+		if err != nil {
+			return nil, "", fmt.Errorf("bencode %s: %w", k, err)
+		}
+	}
+	data, err = bencode.Marshal(dict)
+	return data, "application/x-bittorrent", err
+}
+
+type TrackerPeer struct {
+	PeerID     string    `json:"peer_id"`
+	Addr       string    `json:"addr"`
+	Uploaded   int64     `json:"uploaded"`
+	Downloaded int64     `json:"downloaded"`
+	Left       int64     `json:"left"`
+	Seeder     bool      `json:"seeder"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// SwarmStatus server内置tracker看到的swarm
+type SwarmStatus struct {
+	InfoHash  string         `json:"infohash"`
+	Seeders   int            `json:"seeders"`
+	Leechers  int            `json:"leechers"`
+	Completed int64          `json:"completed"`
+	Peers     []*TrackerPeer `json:"peers"`
+}
+
+// TorrentStatus get_torrent_status的输出, 以及/v1/torrents中的名称、大小和进度
+type TorrentStatus struct {
+	InfoHash       string       `json:"infohash"`
+	Name           string       `json:"name,omitempty"`
+	Exist          bool         `json:"exist"`
+	Seeding        bool         `json:"seeding"`
+	Storage        string       `json:"storage,omitempty"`
+	Swarm          *SwarmStatus `json:"swarm,omitempty"`
+	Length         int64        `json:"length"`
+	BytesCompleted int64        `json:"bytes_completed"`
+	Magnet         string       `json:"magnet,omitempty"`
+}
+
+type SelectedFile struct {
+	Path   string `json:"path"`
+	Local  string `json:"local,omitempty"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+}
+
+// DownloadOutput start_downloading的输出
+type DownloadOutput struct {
+	Mb      memoryBuf      `json:"mb"` // memory存储方式下载完成后的数据
+	Path    string         `json:"path"`
+	Storage string         `json:"storage,omitempty"`
+	JobID   string         `json:"job_id"`
+	Target  string         `json:"target,omitempty"`
+	Files   []SelectedFile `json:"files,omitempty"`
+	Pieces  [][2]int       `json:"pieces,omitempty"`
+}
+
+// Data memory存储方式下载完成后的数据
+func (o *DownloadOutput) Data() []byte {
+	return o.Mb.Data
+}
+
+// 下载任务的状态
+const (
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobCanceled  = "canceled"
+	JobFailed    = "failed"
+)
+
+type JobStatus struct {
+	ID              string          `json:"id"`
+	InfoHash        string          `json:"infohash"`
+	Name            string          `json:"name"`
+	Storage         string          `json:"storage"`
+	State           string          `json:"state"`
+	Error           string          `json:"error,omitempty"`
+	NumPieces       int             `json:"num_pieces"`
+	PiecesCompleted int             `json:"pieces_completed"`
+	PiecesPartial   int             `json:"pieces_partial"`
+	BytesCompleted  int64           `json:"bytes_completed"`
+	Length          int64           `json:"length"`
+	Rate            int64           `json:"rate"`
+	ActivePeers     int             `json:"active_peers"`
+	TotalPeers      int             `json:"total_peers"`
+	Started         time.Time       `json:"started"`
+	Elapsed         float64         `json:"elapsed"`
+	Output          *DownloadOutput `json:"output,omitempty"`
+}
+
+// torrents
+
+// CreateTorrent 制作torrent, memory存储方式的数据登记在server中, 由SeedTorrent开始做种
+func (c *Client) CreateTorrent(ctx context.Context, in *CreateTorrentInput) (*metainfo.MetaInfo, error) {
+	body, err := jsonBody(in.request())
+	if err != nil {
+		return nil, err
+	}
+	data, _, err := c.do(ctx, &request{
+		method:      http.MethodPost,
+		path:        "/v1/torrents",
+		body:        body,
+		contentType: "application/json",
+		accept:      "application/x-bittorrent",
+		idempotent:  true, // 相同的输入得到相同的torrent
+	})
+	if err != nil {
+		return nil, err
+	}
+	return metainfo.Load(bytes.NewReader(data))
+}
+
+// SeedTorrent 开始做种, 只有infohash时server使用本地的torrent
+func (c *Client) SeedTorrent(ctx context.Context, ref *TorrentRef) (*TorrentStatus, error) {
+	ih, err := ref.infoHash()
+	if err != nil {
+		return nil, err
+	}
+	body, contentType, err := ref.body()
+	if err != nil {
+		return nil, err
+	}
+	var status TorrentStatus
+	err = c.getJson(ctx, &request{
+		method:      http.MethodPut,
+		path:        "/v1/torrents/" + ih.HexString() + "/seeding",
+		body:        body,
+		contentType: contentType,
+		idempotent:  true,
+	}, &status)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// StopTorrent 停止做种并卸载torrent, torrent不存在时返回false
+func (c *Client) StopTorrent(ctx context.Context, ih metainfo.Hash) (bool, error) {
+	_, _, err := c.do(ctx, &request{
+		method:     http.MethodDelete,
+		path:       "/v1/torrents/" + ih.HexString(),
+		idempotent: true,
+	})
+	if ErrorCode(err) == CodeTorrentNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// TorrentStatus torrent的状态, torrent不存在时Exist为false
+func (c *Client) TorrentStatus(ctx context.Context, ih metainfo.Hash) (*TorrentStatus, error) {
+	var status TorrentStatus
+	err := c.getJson(ctx, &request{
+		method:     http.MethodGet,
+		path:       "/v1/torrents/" + ih.HexString(),
+		idempotent: true,
+	}, &status)
+	if ErrorCode(err) == CodeTorrentNotFound {
+		return &TorrentStatus{InfoHash: ih.HexString()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ListTorrents server中的所有torrent
+func (c *Client) ListTorrents(ctx context.Context) ([]TorrentStatus, error) {
+	var torrents []TorrentStatus
+	err := c.getJson(ctx, &request{
+		method:     http.MethodGet,
+		path:       "/v1/torrents",
+		idempotent: true,
+	}, &torrents)
+	return torrents, err
+}
+
+// MetaInfo server本地的torrent(client中的torrent或登记的模型版本)
+func (c *Client) MetaInfo(ctx context.Context, ih metainfo.Hash) (*metainfo.MetaInfo, error) {
+	data, _, err := c.do(ctx, &request{
+		method:     http.MethodGet,
+		path:       "/v1/torrents/" + ih.HexString() + "/metainfo",
+		idempotent: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return metainfo.Load(bytes.NewReader(data))
+}
+
+// jobs
+
+// StartDownloading 开始下载, 立即返回任务id, 通过WaitJob等待下载完成
+// 只有infohash/magnet时server在本地没有torrent的情况下从peer获取metainfo
+func (c *Client) StartDownloading(ctx context.Context, ref *TorrentRef) (*DownloadOutput, error) {
+	if _, err := ref.infoHash(); err != nil {
+		return nil, err
+	}
+	body, contentType, err := ref.body()
+	if err != nil {
+		return nil, err
+	}
+	var output DownloadOutput
+	err = c.getJson(ctx, &request{
+		method:      http.MethodPost,
+		path:        "/v1/jobs",
+		body:        body,
+		contentType: contentType,
+		timeout:     2 * time.Minute, // server从peer获取metainfo的时间
+	}, &output)
+	if err != nil {
+		return nil, err
+	}
+	return &output, nil
+}
+
+// Download 下载并等待完成, 返回任务结束时的状态
+func (c *Client) Download(ctx context.Context, ref *TorrentRef) (*JobStatus, error) {
+	output, err := c.StartDownloading(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		status, err := c.WaitJob(ctx, output.JobID, time.Minute)
+		if err != nil {
+			return nil, err
+		}
+		if status.State != JobRunning {
+			return status, nil
+		}
+	}
+}
+
+func (c *Client) Job(ctx context.Context, id string) (*JobStatus, error) {
+	return c.WaitJob(ctx, id, 0)
+}
+
+// WaitJob 等待任务结束, 最多等待wait, 返回等待结束时的状态
+func (c *Client) WaitJob(ctx context.Context, id string, wait time.Duration) (*JobStatus, error) {
+	req := &request{
+		method:     http.MethodGet,
+		path:       "/v1/jobs/" + url.PathEscape(id),
+		idempotent: true,
+		timeout:    wait,
+	}
+	if wait > 0 {
+		req.query = url.Values{"wait": {strconv.FormatFloat(wait.Seconds(), 'f', -1, 64)}}
+	}
+	var status JobStatus
+	err := c.getJson(ctx, req, &status)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (c *Client) ListJobs(ctx context.Context) ([]JobStatus, error) {
+	var jobs []JobStatus
+	err := c.getJson(ctx, &request{
+		method:     http.MethodGet,
+		path:       "/v1/jobs",
+		idempotent: true,
+	}, &jobs)
+	return jobs, err
+}
+
+// CancelJob 取消正在运行的任务, 已经结束的任务被删除, 同时释放memory存储方式的数据
+// 删除后再次调用返回job_not_found
+func (c *Client) CancelJob(ctx context.Context, id string) (*JobStatus, error) {
+	var status JobStatus
+	err := c.getJson(ctx, &request{
+		method:     http.MethodDelete,
+		path:       "/v1/jobs/" + url.PathEscape(id),
+		idempotent: true,
+	}, &status)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// send/recv
+
+// RoundOptions 轮次相关请求的参数
+// 同一个client的Send/CompleteSend/Recv使用同一个RoundOptions
+type RoundOptions struct {
+	Client  string // server分配的client id, 为空时由Send设置; server有参与者列表时使用请求的ip
+	Name    string // Client为空时, Send请求server分配id, 名字只用于显示; 都为空时server按ip统计
+	Round   int    // 轮次, 为0时表示当前轮次
+	Version string // Send: 模型版本, 为空时为send分发的当前版本
+	Samples int64  // Recv: 训练使用的样本数, 聚合时作为权重
+}
+
+func (o *RoundOptions) query() url.Values {
+	q := url.Values{}
+	if o == nil {
+		return q
+	}
+	if o.Client != "" {
+		q.Set("client", o.Client)
+	}
+	if o.Name != "" {
+		q.Set("name", o.Name)
+	}
+	if o.Round != 0 {
+		q.Set("round", strconv.Itoa(o.Round))
+	}
+	if o.Version != "" {
+		q.Set("version", o.Version)
+	}
+	if o.Samples != 0 {
+		q.Set("samples", strconv.FormatInt(o.Samples, 10))
+	}
+	return q
+}
+
+// Send 获取server分发的模型的torrent
+func (c *Client) Send(ctx context.Context, opts *RoundOptions) (*metainfo.MetaInfo, error) {
+	data, header, err := c.do(ctx, &request{
+		method:     http.MethodGet,
+		path:       "/send/",
+		query:      opts.query(),
+		idempotent: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	opts.setClient(header)
+	return metainfo.Load(bytes.NewReader(data))
+}
+
+// 保存server分配的client id
+func (o *RoundOptions) setClient(header http.Header) {
+	if o == nil || header == nil {
+		return
+	}
+	if id := header.Get("X-Client-Id"); id != "" {
+		o.Client = id
+	}
+}
+
+// CompleteSend 通知server模型已经接收完成
+func (c *Client) CompleteSend(ctx context.Context, opts *RoundOptions) error {
+	_, header, err := c.do(ctx, &request{
+		method:     http.MethodPost,
+		path:       "/completesend/",
+		query:      opts.query(),
+		body:       []byte{},
+		idempotent: true,
+	})
+	opts.setClient(header)
+	return err
+}
+
+// Recv 向server回传本轮的更新
+func (c *Client) Recv(ctx context.Context, update []byte, opts *RoundOptions) error {
+	_, header, err := c.do(ctx, &request{
+		method:      http.MethodPost,
+		path:        "/recv/",
+		query:       opts.query(),
+		body:        update,
+		contentType: "application/octet-stream",
+	})
+	opts.setClient(header)
+	return err
+}
+
+// RoundStatus 轮次的状态, round为0时为当前轮次
+func (c *Client) RoundStatus(ctx context.Context, round int) (json.RawMessage, error) {
+	name := "current"
+	if round != 0 {
+		name = strconv.Itoa(round)
+	}
+	data, _, err := c.do(ctx, &request{
+		method:     http.MethodGet,
+		path:       "/v1/rounds/" + name,
+		idempotent: true,
+	})
+	return json.RawMessage(data), err
+}
@@ -0,0 +1,226 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// server http接口的go client
+// torrent/job相关的方法使用/v1/接口, send/recv使用client与server之间的接口
+// 每次请求可以设置超时, 连接失败或502/503/504时按指数退避重试(只重试幂等的请求)
+// 出错时返回*Error, Code为/v1/接口返回的错误码
+
+const (
+	defaultTimeout    = 30 * time.Second
+	defaultRetries    = 2
+	defaultRetryDelay = 500 * time.Millisecond
+)
+
+type Client struct {
+	BaseURL    string        // http://<ServerIP>:<HTTPPort>
+	HTTPClient *http.Client  // 为nil时使用http.DefaultClient
+	Timeout    time.Duration // 每次请求的超时, 为负数时不限制(只受ctx限制)
+	Retries    int           // 失败后重试的次数, 为负数时不重试
+	RetryDelay time.Duration // 第一次重试前等待的时间, 之后每次加倍
+	Token      string        // server开启auth时的bearer token, mTLS在HTTPClient的Transport中配置
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Timeout:    defaultTimeout,
+		Retries:    defaultRetries,
+		RetryDelay: defaultRetryDelay,
+	}
+}
+
+// Error server返回的错误
+// /v1/接口的错误带有Code和InfoHash, 其它接口只有Status和Message
+type Error struct {
+	Status   int    `json:"-"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	InfoHash string `json:"infohash,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("server error %d %s: %s", e.Status, e.Code, e.Message)
+	}
+	return fmt.Sprintf("server error %d: %s", e.Status, e.Message)
+}
+
+// 错误码, 与server的/v1/接口一致
+const (
+	CodeInvalidInput        = "invalid_input"
+	CodeInvalidInfoHash     = "invalid_infohash"
+	CodeInvalidStorage      = "invalid_storage"
+	CodeNotFound            = "not_found"
+	CodeTorrentNotFound     = "torrent_not_found"
+	CodeJobNotFound         = "job_not_found"
+	CodeRoundNotFound       = "round_not_found"
+	CodeModelNotFound       = "model_not_found"
+	CodeMethodNotAllowed    = "method_not_allowed"
+	CodeUnauthenticated     = "unauthenticated"
+	CodeForbidden           = "forbidden"
+	CodeConflict            = "conflict"
+	CodeMetainfoTimeout     = "metainfo_timeout"
+	CodeMetainfoUnavailable = "metainfo_unavailable"
+	CodeInternal            = "internal"
+)
+
+// ErrorCode 返回err中server的错误码, 不是server返回的错误时为空
+func ErrorCode(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
+
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	body        []byte
+	contentType string
+	accept      string
+	idempotent  bool          // 可以安全地重试
+	timeout     time.Duration // 额外的超时, 例如等待任务的时间
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// 发送请求, 返回2xx响应的body
+func (c *Client) do(ctx context.Context, req *request) ([]byte, http.Header, error) {
+	retries := c.Retries
+	if !req.idempotent || retries < 0 {
+		retries = 0
+	}
+	delay := c.RetryDelay
+	for attempt := 0; ; attempt++ {
+		body, header, err := c.doOnce(ctx, req)
+		if err == nil || attempt >= retries || !retryable(err) || ctx.Err() != nil {
+			return body, header, err
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+func (c *Client) doOnce(ctx context.Context, req *request) ([]byte, http.Header, error) {
+	if c.Timeout >= 0 {
+		timeout := c.Timeout
+		if timeout == 0 {
+			timeout = defaultTimeout
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout+req.timeout)
+		defer cancel()
+	}
+	u := c.BaseURL + req.path
+	if len(req.query) != 0 {
+		u += "?" + req.query.Encode()
+	}
+	var body io.Reader
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+	hreq, err := http.NewRequestWithContext(ctx, req.method, u, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.contentType != "" {
+		hreq.Header.Set("Content-Type", req.contentType)
+	}
+	if req.accept != "" {
+		hreq.Header.Set("Accept", req.accept)
+	}
+	if c.Token != "" {
+		hreq.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.httpClient().Do(hreq)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, resp.Header, responseError(resp, data)
+	}
+	return data, resp.Header, nil
+}
+
+// 解析错误响应, /v1/接口为json, 其它接口为文本
+func responseError(resp *http.Response, data []byte) *Error {
+	var envelope struct {
+		Error *Error `json:"error"`
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") &&
+		json.Unmarshal(data, &envelope) == nil && envelope.Error != nil {
+		envelope.Error.Status = resp.StatusCode
+		return envelope.Error
+	}
+	return &Error{Status: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+}
+
+// 连接失败、超时和server暂时不可用时重试
+func retryable(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		switch e.Status {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return e.Code != CodeMetainfoTimeout && e.Code != CodeMetainfoUnavailable
+		}
+		return false
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (c *Client) getJson(ctx context.Context, req *request, v interface{}) error {
+	data, _, err := c.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("json unmarshal %s response: %w", req.path, err)
+	}
+	return nil
+}
+
+func jsonBody(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("json marshal: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 与server真实接口的测试在server的api_test.go中, 这里只测试错误和重试
+
+// 依次返回statuses中的状态码, 最后一个重复使用
+func statusServer(t *testing.T, statuses ...int) (*Client, *int32) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1))
+		if n > len(statuses) {
+			n = len(statuses)
+		}
+		status := statuses[n-1]
+		if status == http.StatusOK {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`[]`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"error":{"code":"internal","message":"unavailable"}}`))
+	}))
+	t.Cleanup(srv.Close)
+	c := New(srv.URL)
+	c.RetryDelay = time.Millisecond
+	return c, &calls
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"code":"torrent_not_found","message":"torrent not found","infohash":"abcd"}}`))
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL).ListTorrents(context.Background())
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("error %v is not *Error", err)
+	}
+	if e.Status != http.StatusNotFound || e.Code != CodeTorrentNotFound || e.InfoHash != "abcd" || e.Message != "torrent not found" {
+		t.Errorf("decoded %+v", e)
+	}
+	if ErrorCode(err) != CodeTorrentNotFound {
+		t.Errorf("ErrorCode = %q", ErrorCode(err))
+	}
+}
+
+func TestTextError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}))
+	defer srv.Close()
+
+	err := New(srv.URL).CompleteSend(context.Background(), nil)
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("error %v is not *Error", err)
+	}
+	if e.Status != http.StatusMethodNotAllowed || e.Code != "" || e.Message != "Invalid request method" {
+		t.Errorf("decoded %+v", e)
+	}
+}
+
+func TestRetryUnavailable(t *testing.T) {
+	c, calls := statusServer(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK)
+	_, err := c.ListJobs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 3 {
+		t.Errorf("%d calls, want 3", *calls)
+	}
+}
+
+func TestRetryLimit(t *testing.T) {
+	c, calls := statusServer(t, http.StatusServiceUnavailable)
+	c.Retries = 1
+	_, err := c.ListJobs(context.Background())
+	if e, ok := err.(*Error); !ok || e.Status != http.StatusServiceUnavailable {
+		t.Fatalf("error %v", err)
+	}
+	if *calls != 2 {
+		t.Errorf("%d calls, want 2", *calls)
+	}
+}
+
+func TestNoRetryClientError(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict} {
+		c, calls := statusServer(t, status, http.StatusOK)
+		_, err := c.ListJobs(context.Background())
+		if e, ok := err.(*Error); !ok || e.Status != status {
+			t.Errorf("status %d: error %v", status, err)
+		}
+		if *calls != 1 {
+			t.Errorf("status %d: %d calls, want 1", status, *calls)
+		}
+	}
+}
+
+func TestNoRetryNotIdempotent(t *testing.T) {
+	c, calls := statusServer(t, http.StatusServiceUnavailable, http.StatusOK)
+	err := c.Recv(context.Background(), []byte("update"), &RoundOptions{})
+	if e, ok := err.(*Error); !ok || e.Status != http.StatusServiceUnavailable {
+		t.Fatalf("error %v", err)
+	}
+	if *calls != 1 {
+		t.Errorf("%d calls, want 1", *calls)
+	}
+}
+
+func TestToken(t *testing.T) {
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	c.Token = "secret"
+	_, err := c.ListJobs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("Authorization = %q", auth)
+	}
+}
@@ -0,0 +1,420 @@
+// gRPC控制面, 与http接口create_torrent/start_seeding/stop_seeding/get_torrent_status/start_downloading/get_job/wait_job对应
+// 两种传输方式共用server中的service层(service.go), 行为一致
+// 下载进度通过server-streaming的WatchDownload推送, 由piece状态变化的订阅驱动
+// memory存储方式的模型数据在消息中传输(CreateTorrentRequest.data, Job.output_data),
+// server的消息大小上限为Grpc.MaxMessageSize, client需要设置grpc.MaxCallRecvMsgSize/MaxCallSendMsgSize
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: control.proto
+
+package controlpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Control_CreateTorrent_FullMethodName    = "/control.v1.Control/CreateTorrent"
+	Control_StartSeeding_FullMethodName     = "/control.v1.Control/StartSeeding"
+	Control_StopSeeding_FullMethodName      = "/control.v1.Control/StopSeeding"
+	Control_GetTorrentStatus_FullMethodName = "/control.v1.Control/GetTorrentStatus"
+	Control_StartDownloading_FullMethodName = "/control.v1.Control/StartDownloading"
+	Control_WatchDownload_FullMethodName    = "/control.v1.Control/WatchDownload"
+	Control_GetJob_FullMethodName           = "/control.v1.Control/GetJob"
+	Control_WaitJob_FullMethodName          = "/control.v1.Control/WaitJob"
+)
+
+// ControlClient is the client API for Control service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ControlClient interface {
+	// 制作torrent, 同create_torrent
+	CreateTorrent(ctx context.Context, in *CreateTorrentRequest, opts ...grpc.CallOption) (*CreateTorrentResponse, error)
+	// 开始做种, 同start_seeding
+	StartSeeding(ctx context.Context, in *TorrentRef, opts ...grpc.CallOption) (*TorrentStatus, error)
+	// 停止做种并卸载torrent, 同stop_seeding
+	StopSeeding(ctx context.Context, in *TorrentRef, opts ...grpc.CallOption) (*StopSeedingResponse, error)
+	// torrent的状态, 同get_torrent_status
+	GetTorrentStatus(ctx context.Context, in *TorrentRef, opts ...grpc.CallOption) (*TorrentStatus, error)
+	// 开始下载, 立即返回任务id, 同start_downloading
+	StartDownloading(ctx context.Context, in *TorrentRef, opts ...grpc.CallOption) (*StartDownloadingResponse, error)
+	// 下载进度, 同progress: piece状态变化和定时的统计, 下载完成或torrent被卸载后结束
+	WatchDownload(ctx context.Context, in *WatchDownloadRequest, opts ...grpc.CallOption) (Control_WatchDownloadClient, error)
+	// 下载任务的状态和结果, 同get_job(GET /v1/jobs/{id}), 带wait_seconds时同?wait=
+	// memory存储方式的数据(output_data)保留到任务超过保留时间或被DELETE /v1/jobs/{id}删除
+	GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error)
+	// 等待任务结束或超时后返回状态, 同wait_job
+	WaitJob(ctx context.Context, in *WaitJobRequest, opts ...grpc.CallOption) (*Job, error)
+}
+
+type controlClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewControlClient(cc grpc.ClientConnInterface) ControlClient {
+	return &controlClient{cc}
+}
+
+func (c *controlClient) CreateTorrent(ctx context.Context, in *CreateTorrentRequest, opts ...grpc.CallOption) (*CreateTorrentResponse, error) {
+	out := new(CreateTorrentResponse)
+	err := c.cc.Invoke(ctx, Control_CreateTorrent_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) StartSeeding(ctx context.Context, in *TorrentRef, opts ...grpc.CallOption) (*TorrentStatus, error) {
+	out := new(TorrentStatus)
+	err := c.cc.Invoke(ctx, Control_StartSeeding_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) StopSeeding(ctx context.Context, in *TorrentRef, opts ...grpc.CallOption) (*StopSeedingResponse, error) {
+	out := new(StopSeedingResponse)
+	err := c.cc.Invoke(ctx, Control_StopSeeding_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) GetTorrentStatus(ctx context.Context, in *TorrentRef, opts ...grpc.CallOption) (*TorrentStatus, error) {
+	out := new(TorrentStatus)
+	err := c.cc.Invoke(ctx, Control_GetTorrentStatus_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) StartDownloading(ctx context.Context, in *TorrentRef, opts ...grpc.CallOption) (*StartDownloadingResponse, error) {
+	out := new(StartDownloadingResponse)
+	err := c.cc.Invoke(ctx, Control_StartDownloading_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) WatchDownload(ctx context.Context, in *WatchDownloadRequest, opts ...grpc.CallOption) (Control_WatchDownloadClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Control_ServiceDesc.Streams[0], Control_WatchDownload_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &controlWatchDownloadClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Control_WatchDownloadClient interface {
+	Recv() (*DownloadProgress, error)
+	grpc.ClientStream
+}
+
+type controlWatchDownloadClient struct {
+	grpc.ClientStream
+}
+
+func (x *controlWatchDownloadClient) Recv() (*DownloadProgress, error) {
+	m := new(DownloadProgress)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *controlClient) GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Control_GetJob_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) WaitJob(ctx context.Context, in *WaitJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Control_WaitJob_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ControlServer is the server API for Control service.
+// All implementations must embed UnimplementedControlServer
+// for forward compatibility
+type ControlServer interface {
+	// 制作torrent, 同create_torrent
+	CreateTorrent(context.Context, *CreateTorrentRequest) (*CreateTorrentResponse, error)
+	// 开始做种, 同start_seeding
+	StartSeeding(context.Context, *TorrentRef) (*TorrentStatus, error)
+	// 停止做种并卸载torrent, 同stop_seeding
+	StopSeeding(context.Context, *TorrentRef) (*StopSeedingResponse, error)
+	// torrent的状态, 同get_torrent_status
+	GetTorrentStatus(context.Context, *TorrentRef) (*TorrentStatus, error)
+	// 开始下载, 立即返回任务id, 同start_downloading
+	StartDownloading(context.Context, *TorrentRef) (*StartDownloadingResponse, error)
+	// 下载进度, 同progress: piece状态变化和定时的统计, 下载完成或torrent被卸载后结束
+	WatchDownload(*WatchDownloadRequest, Control_WatchDownloadServer) error
+	// 下载任务的状态和结果, 同get_job(GET /v1/jobs/{id}), 带wait_seconds时同?wait=
+	// memory存储方式的数据(output_data)保留到任务超过保留时间或被DELETE /v1/jobs/{id}删除
+	GetJob(context.Context, *GetJobRequest) (*Job, error)
+	// 等待任务结束或超时后返回状态, 同wait_job
+	WaitJob(context.Context, *WaitJobRequest) (*Job, error)
+	mustEmbedUnimplementedControlServer()
+}
+
+// UnimplementedControlServer must be embedded to have forward compatible implementations.
+type UnimplementedControlServer struct {
+}
+
+func (UnimplementedControlServer) CreateTorrent(context.Context, *CreateTorrentRequest) (*CreateTorrentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateTorrent not implemented")
+}
+func (UnimplementedControlServer) StartSeeding(context.Context, *TorrentRef) (*TorrentStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartSeeding not implemented")
+}
+func (UnimplementedControlServer) StopSeeding(context.Context, *TorrentRef) (*StopSeedingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StopSeeding not implemented")
+}
+func (UnimplementedControlServer) GetTorrentStatus(context.Context, *TorrentRef) (*TorrentStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTorrentStatus not implemented")
+}
+func (UnimplementedControlServer) StartDownloading(context.Context, *TorrentRef) (*StartDownloadingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartDownloading not implemented")
+}
+func (UnimplementedControlServer) WatchDownload(*WatchDownloadRequest, Control_WatchDownloadServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchDownload not implemented")
+}
+func (UnimplementedControlServer) GetJob(context.Context, *GetJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJob not implemented")
+}
+func (UnimplementedControlServer) WaitJob(context.Context, *WaitJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WaitJob not implemented")
+}
+func (UnimplementedControlServer) mustEmbedUnimplementedControlServer() {}
+
+// UnsafeControlServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ControlServer will
+// result in compilation errors.
+type UnsafeControlServer interface {
+	mustEmbedUnimplementedControlServer()
+}
+
+func RegisterControlServer(s grpc.ServiceRegistrar, srv ControlServer) {
+	s.RegisterService(&Control_ServiceDesc, srv)
+}
+
+func _Control_CreateTorrent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateTorrentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).CreateTorrent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_CreateTorrent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).CreateTorrent(ctx, req.(*CreateTorrentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_StartSeeding_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TorrentRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).StartSeeding(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_StartSeeding_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).StartSeeding(ctx, req.(*TorrentRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_StopSeeding_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TorrentRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).StopSeeding(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_StopSeeding_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).StopSeeding(ctx, req.(*TorrentRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_GetTorrentStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TorrentRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).GetTorrentStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_GetTorrentStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).GetTorrentStatus(ctx, req.(*TorrentRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_StartDownloading_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TorrentRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).StartDownloading(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_StartDownloading_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).StartDownloading(ctx, req.(*TorrentRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_WatchDownload_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchDownloadRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ControlServer).WatchDownload(m, &controlWatchDownloadServer{stream})
+}
+
+type Control_WatchDownloadServer interface {
+	Send(*DownloadProgress) error
+	grpc.ServerStream
+}
+
+type controlWatchDownloadServer struct {
+	grpc.ServerStream
+}
+
+func (x *controlWatchDownloadServer) Send(m *DownloadProgress) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Control_GetJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).GetJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_GetJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).GetJob(ctx, req.(*GetJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_WaitJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WaitJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).WaitJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_WaitJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).WaitJob(ctx, req.(*WaitJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Control_ServiceDesc is the grpc.ServiceDesc for Control service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Control_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "control.v1.Control",
+	HandlerType: (*ControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateTorrent",
+			Handler:    _Control_CreateTorrent_Handler,
+		},
+		{
+			MethodName: "StartSeeding",
+			Handler:    _Control_StartSeeding_Handler,
+		},
+		{
+			MethodName: "StopSeeding",
+			Handler:    _Control_StopSeeding_Handler,
+		},
+		{
+			MethodName: "GetTorrentStatus",
+			Handler:    _Control_GetTorrentStatus_Handler,
+		},
+		{
+			MethodName: "StartDownloading",
+			Handler:    _Control_StartDownloading_Handler,
+		},
+		{
+			MethodName: "GetJob",
+			Handler:    _Control_GetJob_Handler,
+		},
+		{
+			MethodName: "WaitJob",
+			Handler:    _Control_WaitJob_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchDownload",
+			Handler:       _Control_WatchDownload_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "control.proto",
+}
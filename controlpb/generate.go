@@ -0,0 +1,4 @@
+// Package controlpb gRPC控制面的protobuf定义和生成的代码
+package controlpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative control.proto
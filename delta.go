@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// delta torrent
+// 冻结部分层的fine-tuning, 相邻两个版本之间大部分piece不变, 只需要分发变化的部分
+// - create_torrent指定base(上一个版本的infohash)时, 目标版本强制使用与base相同的piece length,
+//   按piece hash比较, 只把变化的piece范围和patch manifest放进delta torrent
+// - 目标版本的infohash只有在piece length也与base相同时, 才等于同样数据的完整torrent的infohash
+// - start_downloading下载完delta torrent后, 把变化的数据应用到本地的base版本上,
+//   按manifest中目标版本的info校验每个piece和infohash, 然后开始做种目标版本
+//
+// delta torrent只有一个文件<name>.delta, 格式:
+//   - 0:4   magic "FLDT"
+//   - 4:12  manifest长度(uint64, little endian)
+//   - manifest(json)
+//   - 变化的数据, 按ranges的顺序拼接
+
+const deltaMagic = "FLDT"
+
+const deltaSuffix = ".delta"
+
+type deltaRange struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+type deltaManifest struct {
+	Base       string       `json:"base"`        // base版本的infohash
+	Target     string       `json:"target"`      // 目标版本的infohash
+	TargetInfo []byte       `json:"target_info"` // 目标版本的info(bencode), 用于校验
+	Ranges     []deltaRange `json:"ranges"`      // 变化的数据在目标版本中的位置
+}
+
+// 是否是delta torrent
+func isDeltaInfo(info *metainfo.Info) bool {
+	return !info.IsDir() && filepath.Ext(info.Name) == deltaSuffix
+}
+
+// 与base比较, 制作目标数据的delta torrent, 返回delta torrent和.delta文件的内容
+// name是目标版本的文件名, 与create_torrent制作完整torrent时相同,
+// 完整torrent的piece length也与base相同时, 两者的infohash一致
+func buildDelta(base *metainfo.Info, baseIH metainfo.Hash, name string, target []byte) (*metainfo.MetaInfo, []byte, error) {
+	if base.IsDir() {
+		return nil, nil, fmt.Errorf("base torrent %s must contain a single file", baseIH.HexString())
+	}
+	targetInfo := metainfo.Info{PieceLength: base.PieceLength}
+	err := buildInfoFromMemory(&targetInfo, target, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	targetInfoBytes, err := bencode.Marshal(targetInfo)
+	if err != nil {
+		return nil, nil, err
+	}
+	manifest := deltaManifest{
+		Base:       baseIH.HexString(),
+		Target:     (&metainfo.MetaInfo{InfoBytes: targetInfoBytes}).HashInfoBytes().HexString(),
+		TargetInfo: targetInfoBytes,
+	}
+
+	// 按piece hash比较, 合并相邻的变化的piece
+	var changed int64
+	for i := 0; i < targetInfo.NumPieces(); i++ {
+		p := targetInfo.Piece(i)
+		if i < base.NumPieces() {
+			bp := base.Piece(i)
+			if bp.Length() == p.Length() && bp.Hash() == p.Hash() {
+				continue
+			}
+		}
+		if n := len(manifest.Ranges); n > 0 && manifest.Ranges[n-1].Offset+manifest.Ranges[n-1].Length == p.Offset() {
+			manifest.Ranges[n-1].Length += p.Length()
+		} else {
+			manifest.Ranges = append(manifest.Ranges, deltaRange{Offset: p.Offset(), Length: p.Length()})
+		}
+		changed += p.Length()
+	}
+	log.Printf("delta %s -> %s: %d ranges, %d of %d bytes changed",
+		manifest.Base, manifest.Target, len(manifest.Ranges), changed, targetInfo.TotalLength())
+
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, nil, err
+	}
+	payload := make([]byte, 12, 12+int64(len(manifestBytes))+changed)
+	copy(payload, deltaMagic)
+	binary.LittleEndian.PutUint64(payload[4:12], uint64(len(manifestBytes)))
+	payload = append(payload, manifestBytes...)
+	for _, r := range manifest.Ranges {
+		payload = append(payload, target[r.Offset:r.Offset+r.Length]...)
+	}
+
+	deltaInfo := metainfo.Info{}
+	err = buildInfoFromMemory(&deltaInfo, payload, name+deltaSuffix)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newMetaInfo(&deltaInfo), payload, nil
+}
+
+// create_torrent指定base时制作delta torrent, 并按存储方法登记.delta文件的内容
+func createDelta(method string, input *createTorrentInput) (*metainfo.MetaInfo, error) {
+	var baseIH metainfo.Hash
+	err := baseIH.FromHexString(input.Base)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base %q: %w", input.Base, err)
+	}
+	t, _, ok := findTorrent(baseIH)
+	if !ok || t.Info() == nil {
+		return nil, fmt.Errorf("base torrent %s is not held locally", input.Base)
+	}
+	// 目标版本使用base的piece length, 指定其它值时得到的infohash与预期不同
+	if input.PieceLength > 0 && int64(input.PieceLength) != t.Info().PieceLength {
+		return nil, fmt.Errorf("piece length %d differs from base piece length %d", input.PieceLength, t.Info().PieceLength)
+	}
+
+	target, name, err := readTorrentInput(method, input)
+	if err != nil {
+		return nil, err
+	}
+	// 按tensor对齐时使用base的piece length, 冻结的层对应的piece保持不变
+	var index *tensorIndex
+	if input.Layout == layoutTensor {
+		target, index, err = alignSafetensors(target, t.Info().PieceLength)
+		if err != nil {
+			return nil, err
+		}
+		name = alignedName(name)
+	}
+
+	mip, payload, err := buildDelta(t.Info(), baseIH, name, target)
+	if err != nil {
+		return nil, err
+	}
+	setTrackers(mip, input.Trackers)
+	err = putTorrentData(method, mip, payload)
+	if err != nil {
+		return nil, err
+	}
+	if index != nil {
+		manifest, _, err := parseDelta(payload)
+		if err != nil {
+			return nil, err
+		}
+		var targetIH metainfo.Hash
+		err = targetIH.FromHexString(manifest.Target)
+		if err != nil {
+			return nil, err
+		}
+		index.InfoHash = manifest.Target
+		index.Name = name
+		setTensorIndex(targetIH, index)
+	}
+	return mip, nil
+}
+
+func parseDelta(payload []byte) (*deltaManifest, []byte, error) {
+	if len(payload) < 12 || !bytes.Equal(payload[:4], []byte(deltaMagic)) {
+		return nil, nil, fmt.Errorf("not a delta file")
+	}
+	n := binary.LittleEndian.Uint64(payload[4:12])
+	if n > uint64(len(payload)-12) {
+		return nil, nil, fmt.Errorf("manifest length %d out of range", n)
+	}
+	var manifest deltaManifest
+	err := json.Unmarshal(payload[12:12+n], &manifest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unmarshal manifest: %w", err)
+	}
+	return &manifest, payload[12+n:], nil
+}
+
+// 本地持有的torrent数据
+func readTorrentData(ih metainfo.Hash) ([]byte, string, error) {
+	t, method, ok := findTorrent(ih)
+	if !ok || t.Info() == nil {
+		return nil, "", fmt.Errorf("torrent %s is not held locally", ih.HexString())
+	}
+	if method == "memory" {
+		mt, ok := memoryTorrents.get(ih)
+		if !ok {
+			return nil, "", fmt.Errorf("torrent %s dropped", ih.HexString())
+		}
+		return mt.mb.Data, method, nil
+	}
+	data, err := os.ReadFile(torrentDataPath(method, ih, t.Info()))
+	return data, method, err
+}
+
+// 把下载完成的delta应用到本地的base版本上, 校验后开始做种目标版本
+// output更新为目标版本的数据/路径
+func applyDelta(method string, deltaMi *metainfo.MetaInfo, output *startDownloadingOutput) error {
+	var payload []byte
+	if method == "memory" {
+		payload = output.Mb.Data
+	} else {
+		var err error
+		payload, err = os.ReadFile(output.Path)
+		if err != nil {
+			return err
+		}
+	}
+	manifest, patch, err := parseDelta(payload)
+	if err != nil {
+		return err
+	}
+
+	// 目标版本的info必须与manifest中的infohash一致
+	targetMi := *deltaMi
+	targetMi.InfoBytes = manifest.TargetInfo
+	targetIH := targetMi.HashInfoBytes()
+	if targetIH.HexString() != manifest.Target {
+		return fmt.Errorf("target info hash %s, manifest says %s", targetIH.HexString(), manifest.Target)
+	}
+	targetInfo, err := targetMi.UnmarshalInfo()
+	if err != nil {
+		return fmt.Errorf("unmarshal target info: %w", err)
+	}
+
+	var baseIH metainfo.Hash
+	err = baseIH.FromHexString(manifest.Base)
+	if err != nil {
+		return fmt.Errorf("invalid base %q: %w", manifest.Base, err)
+	}
+	baseData, baseMethod, err := readTorrentData(baseIH)
+	if err != nil {
+		return fmt.Errorf("read base: %w", err)
+	}
+
+	// 未变化的部分来自base, 变化的部分来自patch
+	target := make([]byte, targetInfo.TotalLength())
+	copy(target, baseData)
+	for _, r := range manifest.Ranges {
+		if r.Offset < 0 || r.Length < 0 || r.Offset+r.Length > int64(len(target)) || r.Length > int64(len(patch)) {
+			return fmt.Errorf("range %d+%d out of bounds", r.Offset, r.Length)
+		}
+		copy(target[r.Offset:], patch[:r.Length])
+		patch = patch[r.Length:]
+	}
+	if len(patch) != 0 {
+		return fmt.Errorf("%d trailing bytes in delta", len(patch))
+	}
+	for i := 0; i < targetInfo.NumPieces(); i++ {
+		p := targetInfo.Piece(i)
+		if metainfo.Hash(sha1.Sum(target[p.Offset():p.Offset()+p.Length()])) != p.Hash() {
+			return fmt.Errorf("piece %d hash mismatch after applying delta", i)
+		}
+	}
+
+	if method == "memory" {
+		mb := &storage.MemoryBuf{
+			Data:   target,
+			Length: int64(len(target)),
+		}
+		memoryTorrents.put(targetIH, mb)
+		output.Mb = *mb
+	} else {
+		path := torrentDataPath(method, targetIH, &targetInfo)
+		// base版本的文件将被覆盖, 不能继续做种
+		if baseMethod == method {
+			if t, _, ok := findTorrent(baseIH); ok && torrentDataPath(method, baseIH, t.Info()) == path {
+				dropTorrent(baseIH)
+			}
+		}
+		err = writeModelParam(path, target)
+		if err != nil {
+			return err
+		}
+		output.Path = path
+	}
+	t, _, err := addTorrent(&targetMi, method)
+	if err != nil {
+		return fmt.Errorf("add target torrent: %w", err)
+	}
+	// 数据已经校验过, 重新检查piece状态后直接开始做种
+	go t.VerifyData()
+	output.Target = targetIH.HexString()
+	log.Printf("delta %s applied onto %s, seeding %s", deltaMi.HashInfoBytes().HexString(), manifest.Base, manifest.Target)
+	return nil
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"server/controlpb"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent/metainfo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpc控制面
+// 与create_torrent/start_seeding/stop_seeding/get_torrent_status/start_downloading/get_job/wait_job对应, 定义见controlpb/control.proto
+// 与http接口共用service层, apiError按状态码转换为grpc的status code, 错误码和infohash写在message中
+// 开启Auth时通过拦截器检查权限(auth.go), 配置了证书时使用TLS
+// WatchDownload与progress相同, 由piece状态变化的订阅驱动
+
+const (
+	defaultGrpcPort           = 50051
+	defaultGrpcMaxMessageSize = 1 << 30
+)
+
+type controlServer struct {
+	controlpb.UnimplementedControlServer
+}
+
+func startGrpc() error {
+	addr := fmt.Sprintf(":%d", optionsStruct.Grpc.Port)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("grpc listen %s: %w", addr, err)
+	}
+	s := newGrpcServer()
+	go func() {
+		err := s.Serve(ln)
+		log.Printf("grpc server stopped: %v", err)
+	}()
+	log.Printf("grpc control plane listening on %s", addr)
+	return nil
+}
+
+func newGrpcServer() *grpc.Server {
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(grpcUnaryAuth),
+		grpc.StreamInterceptor(grpcStreamAuth),
+		// 模型数据在消息中传输, 默认的4MiB不够用
+		grpc.MaxRecvMsgSize(optionsStruct.Grpc.MaxMessageSize),
+		grpc.MaxSendMsgSize(optionsStruct.Grpc.MaxMessageSize),
+	}
+	if serverTLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(serverTLS)))
+	}
+	s := grpc.NewServer(opts...)
+	controlpb.RegisterControlServer(s, &controlServer{})
+	return s
+}
+
+// apiError转换为grpc的status
+func grpcError(err error) error {
+	e := toAPIError(err)
+	code := codes.Internal
+	switch e.status {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.FailedPrecondition
+	case http.StatusBadGateway:
+		code = codes.Unavailable
+	case http.StatusGatewayTimeout:
+		code = codes.DeadlineExceeded
+	}
+	msg := e.Code + ": " + e.Message
+	if e.InfoHash != "" {
+		msg += " (infohash " + e.InfoHash + ")"
+	}
+	return status.Error(code, msg)
+}
+
+// 请求中的torrent, 与readTorrentRequest相同, metainfo中额外的字段可以被请求中的字段覆盖
+func grpcTorrentRequest(ref *controlpb.TorrentRef) (*torrentRequest, error) {
+	var ranges [][]int64
+	for _, r := range ref.Ranges {
+		ranges = append(ranges, []int64{r.Begin, r.End})
+	}
+	if len(ref.Metainfo) == 0 {
+		input := torrentRefInput{
+			InfoHash: ref.Infohash,
+			Magnet:   ref.Magnet,
+			Storage:  ref.Storage,
+			Files:    ref.Files,
+			Ranges:   ranges,
+			Peers:    ref.Peers,
+		}
+		req, err := input.request()
+		if err != nil {
+			return nil, apiErrorf(http.StatusBadRequest, errCodeInvalidInput, "%v", err)
+		}
+		return req, nil
+	}
+
+	req, err := bdecodeTorrentRequest(ref.Metainfo)
+	if err != nil {
+		return nil, apiErrorf(http.StatusBadRequest, errCodeInvalidInput, "%v", err)
+	}
+	if ref.Storage != "" {
+		req.storage = ref.Storage
+	}
+	if len(ref.Files) != 0 || len(ranges) != 0 {
+		req.sel = &downloadSelection{Files: ref.Files, Ranges: ranges}
+	}
+	if len(ref.Peers) != 0 {
+		err = checkPeers(ref.Peers)
+		if err != nil {
+			return nil, apiErrorf(http.StatusBadRequest, errCodeInvalidInput, "%v", err).on(req.ih)
+		}
+		req.peers = append(req.peers, ref.Peers...)
+	}
+	return req, nil
+}
+
+func grpcTorrentStatus(ih metainfo.Hash, s getTorrentStatusOutput) *controlpb.TorrentStatus {
+	out := &controlpb.TorrentStatus{
+		Infohash: ih.HexString(),
+		Exist:    s.Exist,
+		Seeding:  s.Seeding,
+		Storage:  s.Storage,
+	}
+	if s.Swarm != nil {
+		out.Swarm = &controlpb.SwarmStatus{
+			Seeders:   int32(s.Swarm.Seeders),
+			Leechers:  int32(s.Swarm.Leechers),
+			Completed: s.Swarm.Completed,
+		}
+	}
+	return out
+}
+
+func (*controlServer) CreateTorrent(ctx context.Context, in *controlpb.CreateTorrentRequest) (*controlpb.CreateTorrentResponse, error) {
+	input := createTorrentInput{
+		Path:        in.Path,
+		Storage:     in.Storage,
+		Base:        in.Base,
+		Layout:      in.Layout,
+		Files:       in.Files,
+		PieceLength: pieceLengthOption(in.PieceLength),
+	}
+	input.Mb.Data = in.Data
+	input.Mb.Length = int64(len(in.Data))
+	if in.NoTrackers {
+		input.Trackers = [][]string{}
+	}
+	for _, tier := range in.Trackers {
+		input.Trackers = append(input.Trackers, tier.Urls)
+	}
+	mip, err := createTorrent(&input)
+	if err != nil {
+		log.Printf("grpc CreateTorrent error: %v", err)
+		return nil, grpcError(err)
+	}
+	var buf bytes.Buffer
+	err = mip.Write(&buf)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &controlpb.CreateTorrentResponse{
+		Infohash: mip.HashInfoBytes().HexString(),
+		Magnet:   magnetURI(mip),
+		Metainfo: buf.Bytes(),
+	}, nil
+}
+
+func (*controlServer) StartSeeding(ctx context.Context, ref *controlpb.TorrentRef) (*controlpb.TorrentStatus, error) {
+	req, err := grpcTorrentRequest(ref)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	s, err := startSeeding(ctx, req)
+	if err != nil {
+		log.Printf("grpc StartSeeding error: %v", err)
+		return nil, grpcError(err)
+	}
+	return grpcTorrentStatus(req.ih, *s), nil
+}
+
+func (*controlServer) StopSeeding(ctx context.Context, ref *controlpb.TorrentRef) (*controlpb.StopSeedingResponse, error) {
+	req, err := grpcTorrentRequest(ref)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &controlpb.StopSeedingResponse{Stopped: stopSeeding(req.ih)}, nil
+}
+
+func (*controlServer) GetTorrentStatus(ctx context.Context, ref *controlpb.TorrentRef) (*controlpb.TorrentStatus, error) {
+	req, err := grpcTorrentRequest(ref)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return grpcTorrentStatus(req.ih, torrentStatus(req.ih)), nil
+}
+
+func (*controlServer) StartDownloading(ctx context.Context, ref *controlpb.TorrentRef) (*controlpb.StartDownloadingResponse, error) {
+	req, err := grpcTorrentRequest(ref)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	output, err := startDownloading(ctx, req)
+	if err != nil {
+		log.Printf("grpc StartDownloading error: %v", err)
+		return nil, grpcError(err)
+	}
+	return grpcDownloadOutput(output), nil
+}
+
+func grpcDownloadOutput(output *startDownloadingOutput) *controlpb.StartDownloadingResponse {
+	resp := &controlpb.StartDownloadingResponse{
+		JobId:   output.JobID,
+		Storage: output.Storage,
+		Path:    output.Path,
+		Target:  output.Target,
+	}
+	for _, f := range output.Files {
+		resp.Files = append(resp.Files, &controlpb.SelectedFile{
+			Path:   f.Path,
+			Local:  f.Local,
+			Offset: f.Offset,
+			Length: f.Length,
+		})
+	}
+	for _, p := range output.Pieces {
+		resp.Pieces = append(resp.Pieces, &controlpb.PieceRange{Begin: int32(p[0]), End: int32(p[1])})
+	}
+	return resp
+}
+
+func grpcJob(s downloadJobStatus) *controlpb.Job {
+	job := &controlpb.Job{
+		Id:              s.ID,
+		Infohash:        s.InfoHash,
+		Name:            s.Name,
+		Storage:         s.Storage,
+		State:           s.State,
+		Error:           s.Error,
+		NumPieces:       int32(s.NumPieces),
+		PiecesCompleted: int32(s.PiecesCompleted),
+		PiecesPartial:   int32(s.PiecesPartial),
+		BytesCompleted:  s.BytesCompleted,
+		Length:          s.Length,
+		Rate:            s.Rate,
+		ActivePeers:     int32(s.ActivePeers),
+		TotalPeers:      int32(s.TotalPeers),
+		Started:         timestamppb.New(s.Started),
+		ElapsedSeconds:  s.Elapsed,
+	}
+	if s.Output != nil {
+		job.Output = grpcDownloadOutput(s.Output)
+		job.OutputData = s.Output.Mb.Data
+	}
+	return job
+}
+
+func grpcFindJob(id string) (*downloadJob, error) {
+	j, ok := downloadJobs.get(id)
+	if !ok {
+		return nil, grpcError(apiErrorf(http.StatusNotFound, errCodeJobNotFound, "job %q not found", id))
+	}
+	return j, nil
+}
+
+// 等待任务结束, timeout为0时一直等待
+func grpcWaitJob(ctx context.Context, j *downloadJob, seconds float64) error {
+	if seconds < 0 {
+		return grpcError(apiErrorf(http.StatusBadRequest, errCodeInvalidInput, "invalid wait %v", seconds))
+	}
+	var timeout <-chan time.Time
+	if seconds > 0 {
+		timer := time.NewTimer(time.Duration(seconds * float64(time.Second)))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-j.done:
+	case <-timeout:
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	return nil
+}
+
+func (*controlServer) GetJob(ctx context.Context, in *controlpb.GetJobRequest) (*controlpb.Job, error) {
+	j, err := grpcFindJob(in.JobId)
+	if err != nil {
+		return nil, err
+	}
+	if in.WaitSeconds != 0 {
+		err = grpcWaitJob(ctx, j, in.WaitSeconds)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return grpcJob(j.Status()), nil
+}
+
+func (*controlServer) WaitJob(ctx context.Context, in *controlpb.WaitJobRequest) (*controlpb.Job, error) {
+	j, err := grpcFindJob(in.JobId)
+	if err != nil {
+		return nil, err
+	}
+	err = grpcWaitJob(ctx, j, in.TimeoutSeconds)
+	if err != nil {
+		return nil, err
+	}
+	return grpcJob(j.Status()), nil
+}
+
+func grpcDownloadStats(ev statsEvent) *controlpb.DownloadStats {
+	return &controlpb.DownloadStats{
+		Infohash:        ev.InfoHash,
+		NumPieces:       int32(ev.NumPieces),
+		PiecesCompleted: int32(ev.PiecesCompleted),
+		PiecesPartial:   int32(ev.PiecesPartial),
+		BytesCompleted:  ev.BytesCompleted,
+		Length:          ev.Length,
+		Rate:            ev.Rate,
+		ActivePeers:     int32(ev.ActivePeers),
+		TotalPeers:      int32(ev.TotalPeers),
+	}
+}
+
+func (*controlServer) WatchDownload(in *controlpb.WatchDownloadRequest, stream controlpb.Control_WatchDownloadServer) error {
+	var ih metainfo.Hash
+	var pieces [][2]int
+	if in.Infohash != "" {
+		err := ih.FromHexString(in.Infohash)
+		if err != nil {
+			return grpcError(apiErrorf(http.StatusBadRequest, errCodeInvalidInfoHash, "invalid infohash %q: %v", in.Infohash, err))
+		}
+		pieces = downloadJobs.pieces(ih)
+	} else {
+		j, ok := downloadJobs.get(in.JobId)
+		if !ok {
+			return grpcError(apiErrorf(http.StatusNotFound, errCodeJobNotFound, "job %q not found", in.JobId))
+		}
+		ih, pieces = j.ih, j.output.Pieces
+	}
+	interval, err := progressInterval(in.IntervalSeconds)
+	if err != nil {
+		return grpcError(apiErrorf(http.StatusBadRequest, errCodeInvalidInput, "%v", err))
+	}
+	t, _, ok := findTorrent(ih)
+	if !ok {
+		return grpcError(apiErrorf(http.StatusNotFound, errCodeTorrentNotFound, "torrent %s not found", ih.HexString()).on(ih))
+	}
+
+	err = watchProgress(stream.Context(), t, ih, pieces, interval, func(event string, v interface{}) error {
+		var p controlpb.DownloadProgress
+		switch event {
+		case "piece":
+			ev := v.(pieceEvent)
+			p.Event = &controlpb.DownloadProgress_Piece{Piece: &controlpb.PieceStateChange{
+				Index:    int32(ev.Index),
+				Complete: ev.Complete,
+				Ok:       ev.Ok,
+				Partial:  ev.Partial,
+				Checking: ev.Checking,
+			}}
+		case "stats":
+			p.Event = &controlpb.DownloadProgress_Stats{Stats: grpcDownloadStats(v.(statsEvent))}
+		case "complete":
+			p.Event = &controlpb.DownloadProgress_Complete{Complete: grpcDownloadStats(v.(statsEvent))}
+		case "dropped":
+			p.Event = &controlpb.DownloadProgress_Dropped{Dropped: grpcDownloadStats(v.(statsEvent))}
+		default:
+			return nil
+		}
+		return stream.Send(&p)
+	})
+	if err != nil {
+		log.Printf("grpc WatchDownload %s error: %v", ih.HexString(), err)
+	}
+	return err
+}
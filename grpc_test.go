@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"server/controlpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func newTestGrpcClient(t *testing.T) controlpb.ControlClient {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newGrpcServer()
+	go s.Serve(ln)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.Dial(ln.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(optionsStruct.Grpc.MaxMessageSize),
+			grpc.MaxCallSendMsgSize(optionsStruct.Grpc.MaxMessageSize),
+		))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return controlpb.NewControlClient(conn)
+}
+
+// 超过grpc默认4MiB的模型数据
+func TestGrpcLargeMessage(t *testing.T) {
+	c := newTestGrpcClient(t)
+	resp, err := c.CreateTorrent(context.Background(), &controlpb.CreateTorrentRequest{
+		Data:    testData(6<<20, 8),
+		Storage: "memory",
+	})
+	if err != nil {
+		t.Fatalf("CreateTorrent: %v", err)
+	}
+	if resp.Infohash == "" || len(resp.Metainfo) == 0 {
+		t.Errorf("CreateTorrent response %v", resp)
+	}
+}
+
+// 很小的interval不能使time.NewTicker panic
+func TestGrpcWatchDownloadInterval(t *testing.T) {
+	c := newTestGrpcClient(t)
+	ctx := context.Background()
+
+	path := filepath.Join(configStruct.Model.ModelPath, "watch.bin")
+	err := os.WriteFile(path, testData(128<<10, 9), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := c.CreateTorrent(ctx, &controlpb.CreateTorrentRequest{Path: path, Storage: "tmpfs"})
+	if err != nil {
+		t.Fatalf("CreateTorrent: %v", err)
+	}
+	ref := &controlpb.TorrentRef{Metainfo: created.Metainfo, Storage: "tmpfs"}
+	_, err = c.StartSeeding(ctx, ref)
+	if err != nil {
+		t.Fatalf("StartSeeding: %v", err)
+	}
+	defer c.StopSeeding(ctx, ref)
+
+	stream, err := c.WatchDownload(ctx, &controlpb.WatchDownloadRequest{Infohash: created.Infohash, IntervalSeconds: 1e-12})
+	if err != nil {
+		t.Fatalf("WatchDownload: %v", err)
+	}
+	var complete bool
+	for {
+		p, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("WatchDownload recv: %v", err)
+		}
+		complete = p.GetComplete() != nil
+	}
+	if !complete {
+		t.Errorf("WatchDownload did not end with complete")
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/sha1"
+	"expvar"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/dustin/go-humanize"
+)
+
+// 并行计算piece hash
+// metainfo.Info.GeneratePieces在请求的goroutine中依次计算每个piece的hash, 几个GB的模型需要几十秒
+// - 一个goroutine按顺序大块读取文件(每次至少hashReadSize), 避免随机读
+// - Torrent.HashWorkers个goroutine并行计算sha1
+// - 内存中的数据不需要读取, 直接分给worker
+// 吞吐量记录在日志和expvar(/debug/vars中的piece_hashing)中
+
+const hashReadSize = 8 << 20
+
+var hashingStats = expvar.NewMap("piece_hashing")
+
+type hashJob struct {
+	index int // 第一个piece的序号
+	data  []byte
+	buf   *[]byte // 为nil时data不是从bufPool中分配的
+}
+
+func hashWorkers() int {
+	if optionsStruct != nil && optionsStruct.Torrent.HashWorkers > 0 {
+		return optionsStruct.Torrent.HashWorkers
+	}
+	return runtime.NumCPU()
+}
+
+// 计算info中所有文件的piece hash, 与Info.GeneratePieces相同
+func generatePieces(info *metainfo.Info, open func(fi metainfo.FileInfo) (io.ReadCloser, error)) error {
+	if info.PieceLength <= 0 {
+		return fmt.Errorf("piece length must be positive")
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		var err error
+		for _, fi := range info.UpvertedFiles() {
+			var r io.ReadCloser
+			r, err = open(fi)
+			if err != nil {
+				err = fmt.Errorf("error opening %v: %w", fi, err)
+				break
+			}
+			var n int64
+			n, err = io.CopyN(pw, r, fi.Length)
+			r.Close()
+			if n != fi.Length {
+				err = fmt.Errorf("error copying %v: %v", fi, err)
+				break
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+	defer pr.Close()
+
+	// 每次读取整数个piece
+	piecesPerRead := int(hashReadSize / info.PieceLength)
+	if piecesPerRead < 1 {
+		piecesPerRead = 1
+	}
+	readSize := int64(piecesPerRead) * info.PieceLength
+	bufPool := sync.Pool{New: func() interface{} {
+		buf := make([]byte, readSize)
+		return &buf
+	}}
+	return hashPieces(info, info.TotalLength(), func(jobs chan<- hashJob) error {
+		for index := 0; ; index += piecesPerRead {
+			buf := bufPool.Get().(*[]byte)
+			n, err := io.ReadFull(pr, *buf)
+			if n > 0 {
+				jobs <- hashJob{index: index, data: (*buf)[:n], buf: buf}
+			} else {
+				bufPool.Put(buf)
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}, &bufPool)
+}
+
+// 与Info.BuildFromMemory相同, 但是并行计算piece hash
+// info.PieceLength为0时使用torrent库的默认选择
+func buildInfoFromMemory(info *metainfo.Info, data []byte, name string) error {
+	info.Name = name
+	info.Length = int64(len(data))
+	info.Files = nil
+	if info.PieceLength == 0 {
+		info.PieceLength = metainfo.ChoosePieceLength(info.Length)
+	}
+	return generatePiecesFromMemory(info, data)
+}
+
+// 计算内存中数据的piece hash
+func generatePiecesFromMemory(info *metainfo.Info, data []byte) error {
+	if info.PieceLength <= 0 {
+		return fmt.Errorf("piece length must be positive")
+	}
+	piecesPerJob := int(hashReadSize / info.PieceLength)
+	if piecesPerJob < 1 {
+		piecesPerJob = 1
+	}
+	jobSize := int64(piecesPerJob) * info.PieceLength
+	return hashPieces(info, int64(len(data)), func(jobs chan<- hashJob) error {
+		for off, index := int64(0), 0; off < int64(len(data)); off, index = off+jobSize, index+piecesPerJob {
+			end := off + jobSize
+			if end > int64(len(data)) {
+				end = int64(len(data))
+			}
+			jobs <- hashJob{index: index, data: data[off:end]}
+		}
+		return nil
+	}, nil)
+}
+
+// produce按顺序产生数据, worker并行计算sha1, 结果写入info.Pieces
+func hashPieces(info *metainfo.Info, totalLength int64, produce func(jobs chan<- hashJob) error, bufPool *sync.Pool) error {
+	started := time.Now()
+	numPieces := int((totalLength + info.PieceLength - 1) / info.PieceLength)
+	pieces := make([]byte, numPieces*sha1.Size)
+	workers := hashWorkers()
+
+	jobs := make(chan hashJob, workers)
+	var wg sync.WaitGroup
+	var hashed int64
+	var mu sync.Mutex
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				for off, index := int64(0), job.index; off < int64(len(job.data)); off, index = off+info.PieceLength, index+1 {
+					end := off + info.PieceLength
+					if end > int64(len(job.data)) {
+						end = int64(len(job.data))
+					}
+					if index >= numPieces {
+						break
+					}
+					sum := sha1.Sum(job.data[off:end])
+					copy(pieces[index*sha1.Size:], sum[:])
+				}
+				mu.Lock()
+				hashed += int64(len(job.data))
+				mu.Unlock()
+				if job.buf != nil {
+					bufPool.Put(job.buf)
+				}
+			}
+		}()
+	}
+	err := produce(jobs)
+	close(jobs)
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	if hashed != totalLength {
+		return fmt.Errorf("hashed %d bytes, expected %d", hashed, totalLength)
+	}
+	info.Pieces = pieces
+
+	elapsed := time.Since(started)
+	rate := float64(hashed) / elapsed.Seconds()
+	hashingStats.Add("bytes", hashed)
+	hashingStats.Add("pieces", int64(numPieces))
+	hashingStats.AddFloat("seconds", elapsed.Seconds())
+	last := new(expvar.Float)
+	last.Set(rate)
+	hashingStats.Set("last_rate", last)
+	log.Printf("hashed %d pieces, %s in %v with %d workers, %s/s",
+		numPieces, humanize.IBytes(uint64(hashed)), elapsed, workers, humanize.IBytes(uint64(rate)))
+	return nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// 多级聚合
+// 配置了Hierarchy.Parent的server同时是上一级server的client:
+// - 分发: 第一次send时从上一级获取torrent, 下载并在本地做种, 再把同一个torrent发给自己的client
+// - 回传: 本轮所有client回传后聚合, 把部分聚合的结果(带样本数)回传给上一级, 而不是作为自己的下一轮模型
+// 上一级server的Client.TotalPeers/IPList应该是下一级server的数量/ip
+// 上一级没有参与者列表时, 使用上一级在send时分配的id(X-Client-Id), Hierarchy.Name只用于显示
+// 请求中带上上一级的轮次(X-Round), 回传后获取模型时带上after: 上一级开启下一轮之前返回409, 不会得到旧的模型
+
+func hasParent() bool {
+	return optionsStruct.Hierarchy.Parent != ""
+}
+
+// 上一级server分配的client id, 以及模型所在的上一级轮次
+var (
+	parentMu        sync.Mutex
+	parentClientID  string
+	parentRound     int  // 从上一级获取的模型所在的轮次, 0表示未知
+	parentForwarded bool // 已经把parentRound的聚合结果回传给上一级
+)
+
+// 在上一级server中的名字, 默认为hostname
+// Server.ServerIP是上一级server的地址, 不能作为名字
+func hierarchyName() string {
+	if optionsStruct.Hierarchy.Name != "" {
+		return optionsStruct.Hierarchy.Name
+	}
+	name, _ := os.Hostname()
+	return name
+}
+
+// 请求中的上一级轮次
+func parentRoundQuery() url.Values {
+	query := url.Values{}
+	parentMu.Lock()
+	defer parentMu.Unlock()
+	if parentRound != 0 {
+		query.Set("round", strconv.Itoa(parentRound))
+	}
+	return query
+}
+
+// 上一级server的url, Parent可以是host:port或完整的url
+func parentURL(endpoint string, query url.Values) string {
+	base := optionsStruct.Hierarchy.Parent
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("name", hierarchyName())
+	return fmt.Sprintf("%s/%s/?%s", strings.TrimSuffix(base, "/"), endpoint, query.Encode())
+}
+
+const defaultParentTimeout = 300
+
+// 请求上一级server的超时, 上一级没有响应时不会一直等待
+func parentClient() *http.Client {
+	return &http.Client{Timeout: time.Duration(optionsStruct.Hierarchy.Timeout) * time.Second}
+}
+
+func parentRequest(method, endpoint string, query url.Values, body []byte) ([]byte, http.Header, error) {
+	req, err := http.NewRequest(method, parentURL(endpoint, query), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	if optionsStruct.Hierarchy.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+optionsStruct.Hierarchy.Token)
+	}
+	parentMu.Lock()
+	if parentClientID != "" {
+		req.Header.Set(clientIDHeader, parentClientID)
+	}
+	parentMu.Unlock()
+	resp, err := parentClient().Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	parentMu.Lock()
+	if id := resp.Header.Get(clientIDHeader); id != "" {
+		parentClientID = id
+	} else if resp.StatusCode == http.StatusForbidden {
+		// 上一级重启后之前分配的id失效, 下一次请求重新分配
+		parentClientID = ""
+	}
+	parentMu.Unlock()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("parent %s: %s: %s", endpoint, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return respBody, resp.Header, nil
+}
+
+// 从上一级server获取torrent
+// 已经回传过时获取下一轮的模型, 上一级还没有开启下一轮时返回错误
+func fetchFromParent() (*metainfo.MetaInfo, error) {
+	query := url.Values{}
+	parentMu.Lock()
+	if parentForwarded {
+		query.Set("after", strconv.Itoa(parentRound))
+	}
+	parentMu.Unlock()
+	body, header, err := parentRequest("GET", "send", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	var mi metainfo.MetaInfo
+	err = bencode.Unmarshal(body, &mi)
+	if err != nil {
+		return nil, fmt.Errorf("bdecode torrent from parent: %w", err)
+	}
+	if round, err := strconv.Atoi(header.Get(roundHeader)); err == nil {
+		parentMu.Lock()
+		parentRound = round
+		parentForwarded = false
+		parentMu.Unlock()
+	}
+	return &mi, nil
+}
+
+var parentFetchMu sync.Mutex // 同时只有一个请求从上一级获取torrent
+
+// 还没有模型时从上一级获取torrent并在本地做种, 设置为当前模型
+// 访问上一级时不持有mutex, 上一级很慢时不阻塞其它请求; 出错时返回http状态码
+func prepareParentModel() (int, error) {
+	parentFetchMu.Lock()
+	defer parentFetchMu.Unlock()
+	mutex.Lock()
+	ready := mi != nil
+	mutex.Unlock()
+	if ready {
+		return 0, nil
+	}
+
+	fetched, err := fetchFromParent()
+	if err != nil {
+		return http.StatusBadGateway, fmt.Errorf("fetch torrent from parent error: %w", err)
+	}
+	err = seedFromParent(fetched)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("seed torrent from parent error: %w", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if mi == nil {
+		mi = fetched
+		// 登记为新的版本
+		err = publishCurrentModelLocked(storageMethod)
+		if err != nil {
+			log.Printf("publish model %s error: %v", configStruct.Model.ModelName, err)
+		}
+	}
+	return 0, nil
+}
+
+// 在本地下载并做种上一级的torrent, 完成后通知上一级
+// 下载过程中已经完成的piece就可以分享给自己的client
+func seedFromParent(mip *metainfo.MetaInfo) error {
+	info, err := mip.UnmarshalInfo()
+	if err != nil {
+		return err
+	}
+	t, cl, err := addTorrent(mip, storageMethod)
+	if err != nil {
+		return err
+	}
+	output := downloadOutput(storageMethod, mip, &info)
+	query := parentRoundQuery()
+	job := downloadJobs.start(mip, storageMethod, t, cl, output, func(output *startDownloadingOutput) error {
+		_, _, err := parentRequest("POST", "completesend", query, []byte(hierarchyName()))
+		return err
+	})
+	log.Printf("download %s from parent %s, job %s", mip.HashInfoBytes().HexString(), optionsStruct.Hierarchy.Parent, job.id)
+	return nil
+}
+
+// 把部分聚合的结果回传给上一级
+// 带上获取模型时的轮次, 上一级已经进入其它轮次时返回错误
+func forwardToParent(data []byte, numSamples int64) error {
+	query := parentRoundQuery()
+	query.Set("samples", strconv.FormatInt(numSamples, 10))
+	_, _, err := parentRequest("POST", "recv", query, data)
+	if err != nil {
+		return err
+	}
+	parentMu.Lock()
+	parentForwarded = true
+	parentMu.Unlock()
+	return nil
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"server/utils"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/dustin/go-humanize"
+)
+
+// 下载任务
+// start_downloading立即返回任务id, 下载在后台进行
+// 通过list_jobs/get_job/wait_job/cancel_job查询或取消任务
+// 结束的任务保留jobRetention, 最多保留maxFinishedJobs个
+// memory存储方式的数据保留到任务被删除(超过保留时间, 或者DELETE /v1/jobs/{id}删除结束的任务)
+// torrent被卸载(stop_seeding、DELETE /v1/torrents/{ih}、旧版本retire)时任务结束, 状态为canceled
+
+const (
+	jobRetention    = 10 * time.Minute
+	maxFinishedJobs = 100
+)
+
+const (
+	jobRunning   = "running"
+	jobCompleted = "completed"
+	jobCanceled  = "canceled"
+	jobFailed    = "failed" // 下载完成, 但onComplete返回错误
+)
+
+type downloadJob struct {
+	id      string
+	ih      metainfo.Hash
+	method  string
+	t       *torrent.Torrent
+	cl      *torrent.Client
+	output  startDownloadingOutput
+	started time.Time
+
+	cancel     context.CancelFunc
+	done       chan struct{}                       // 任务结束后关闭
+	onComplete func(*startDownloadingOutput) error // 下载完成后调用, 可以修改下载结果, 可以为nil
+
+	mu    sync.Mutex
+	state string
+	ended time.Time
+	final *downloadJobStatus // 任务结束时的状态, torrent可能已经被卸载
+}
+
+type downloadJobStatus struct {
+	ID              string    `json:"id"`
+	InfoHash        string    `json:"infohash"`
+	Name            string    `json:"name"`
+	Storage         string    `json:"storage"`
+	State           string    `json:"state"`
+	Error           string    `json:"error,omitempty"`
+	NumPieces       int       `json:"num_pieces"`
+	PiecesCompleted int       `json:"pieces_completed"`
+	PiecesPartial   int       `json:"pieces_partial"`
+	BytesCompleted  int64     `json:"bytes_completed"`
+	Length          int64     `json:"length"`
+	Rate            int64     `json:"rate"` // 平均下载速度, Bytes/s
+	ActivePeers     int       `json:"active_peers"`
+	TotalPeers      int       `json:"total_peers"`
+	Started         time.Time `json:"started"`
+	Elapsed         float64   `json:"elapsed"` // 秒
+	// 下载结果, 只有完成后才有
+	Output *startDownloadingOutput `json:"output,omitempty"`
+}
+
+type jobManager struct {
+	ctx    context.Context // 所有任务的ctx的parent, 进程退出时取消
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	nextID int
+	jobs   map[string]*downloadJob
+}
+
+var downloadJobs = newJobManager()
+
+func newJobManager() *jobManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &jobManager{
+		ctx:    ctx,
+		cancel: cancel,
+		jobs:   make(map[string]*downloadJob),
+	}
+}
+
+// start 创建下载任务并在后台下载
+// 同一个torrent已经有正在运行的任务, 并且选择的文件和piece相同时, 直接返回该任务
+// 下载所有piece的任务的结果中没有请求的文件, 不能代替部分下载的任务
+func (m *jobManager) start(mi *metainfo.MetaInfo, method string, t *torrent.Torrent, cl *torrent.Client, output startDownloadingOutput, onComplete func(*startDownloadingOutput) error) *downloadJob {
+	ih := mi.HashInfoBytes()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneLocked()
+	for _, j := range m.jobs {
+		if j.ih == ih && j.State() == jobRunning &&
+			reflect.DeepEqual(j.output.Pieces, output.Pieces) && reflect.DeepEqual(j.output.Files, output.Files) {
+			return j
+		}
+	}
+	m.nextID++
+	id := strconv.Itoa(m.nextID)
+
+	// ctx在任务被取消、torrent被卸载或进程退出(shutdown)时取消
+	ctx, cancel := context.WithCancel(m.ctx)
+	output.JobID = id
+	j := &downloadJob{
+		id:         id,
+		ih:         ih,
+		method:     method,
+		t:          t,
+		cl:         cl,
+		output:     output,
+		started:    time.Now(),
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		onComplete: onComplete,
+		state:      jobRunning,
+	}
+	m.jobs[id] = j
+	go j.run(ctx)
+	log.Printf("download job %s for %s started", id, ih.HexString())
+	return j
+}
+
+// 删除超过jobRetention的结束的任务, 结束的任务超过maxFinishedJobs时删除最早结束的
+func (m *jobManager) pruneLocked() {
+	var finished []*downloadJob
+	for id, j := range m.jobs {
+		j.mu.Lock()
+		ended := j.ended
+		j.mu.Unlock()
+		if ended.IsZero() {
+			continue
+		}
+		if time.Since(ended) > jobRetention {
+			delete(m.jobs, id)
+			continue
+		}
+		finished = append(finished, j)
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(a, b int) bool {
+		return finished[a].ended.Before(finished[b].ended)
+	})
+	for _, j := range finished[:len(finished)-maxFinishedJobs] {
+		delete(m.jobs, j.id)
+	}
+}
+
+// shutdown 取消所有正在运行的任务并等待它们结束, 进程退出前调用
+func (m *jobManager) shutdown() {
+	m.cancel()
+	for _, j := range m.list() {
+		<-j.done
+	}
+}
+
+// delete 取消正在运行的任务; 已经结束的任务从列表中删除, 同时释放memory存储方式的数据
+// 返回删除前的状态, 不包括memory存储方式的数据
+func (m *jobManager) delete(j *downloadJob) downloadJobStatus {
+	if j.State() == jobRunning {
+		j.Cancel()
+		return j.Status()
+	}
+	m.remove(j.id)
+	status := j.Status()
+	if status.Output != nil {
+		output := *status.Output
+		output.Mb = storage.MemoryBuf{}
+		status.Output = &output
+	}
+	return status
+}
+
+func (m *jobManager) remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.jobs, id)
+}
+
+func (m *jobManager) get(id string) (*downloadJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	return j, ok
+}
+
+// torrent的任务需要下载的piece, 用于判断下载进度是否完成
+// 优先使用正在运行的任务, 有任务下载所有piece或者没有任务时返回nil(所有piece)
+func (m *jobManager) pieces(ih metainfo.Hash) [][2]int {
+	var running, all []*downloadJob
+	for _, j := range m.list() {
+		if j.ih != ih {
+			continue
+		}
+		all = append(all, j)
+		if j.State() == jobRunning {
+			running = append(running, j)
+		}
+	}
+	if len(running) > 0 {
+		all = running
+	}
+	var pieces [][2]int
+	for _, j := range all {
+		if j.output.Pieces == nil {
+			return nil
+		}
+		pieces = append(pieces, j.output.Pieces...)
+	}
+	return pieces
+}
+
+func (m *jobManager) list() []*downloadJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := make([]*downloadJob, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(a, b int) bool {
+		return jobs[a].started.Before(jobs[b].started)
+	})
+	return jobs
+}
+
+func (j *downloadJob) run(ctx context.Context) {
+	defer close(j.done)
+	defer j.cancel()
+
+	// torrent被卸载后不会再有piece完成, 取消任务
+	go func() {
+		select {
+		case <-j.t.Closed():
+			j.cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// create a goroutine to print the download process
+	utils.TorrentBar(ctx, j.t, false)
+	select {
+	case <-ctx.Done():
+	case <-j.t.GotInfo():
+		if j.output.Pieces == nil {
+			j.t.DownloadAll() // 只是声明哪些piece(所有)需要被下载
+			// 检查所有的piece都已经被下载(发布/订阅模式)
+			utils.WaitForPieces(ctx, j.t, 0, j.t.NumPieces())
+			break
+		}
+		// 部分下载: 只声明和等待覆盖请求的文件/范围的piece
+		for _, r := range j.output.Pieces {
+			j.t.DownloadPieces(r[0], r[1])
+		}
+		for _, r := range j.output.Pieces {
+			utils.WaitForPieces(ctx, j.t, r[0], r[1])
+		}
+	}
+
+	// torrent被卸载时WaitForPieces也会返回, 先于ctx检查
+	select {
+	case <-j.t.Closed():
+		j.finish(jobCanceled, fmt.Errorf("torrent %s dropped", j.ih.HexString()))
+		return
+	default:
+	}
+	if ctx.Err() != nil {
+		j.finish(jobCanceled, ctx.Err())
+		return
+	}
+	if j.output.Pieces == nil {
+		log.Printf("download job %s downloaded ALL the torrents", j.id)
+	} else {
+		log.Printf("download job %s downloaded pieces %v", j.id, j.output.Pieces)
+	}
+	logDownloadStats(j.cl, j.started)
+
+	if j.method == "memory" {
+		// 数据保存在memory manager中
+		mt, ok := memoryTorrents.get(j.ih)
+		if !ok {
+			j.finish(jobCanceled, fmt.Errorf("torrent %s dropped", j.ih.HexString()))
+			return
+		}
+		j.output.Mb = *mt.mb
+	}
+	if j.onComplete != nil {
+		err := j.onComplete(&j.output)
+		if err != nil {
+			j.finish(jobFailed, err)
+			return
+		}
+	}
+	j.finish(jobCompleted, nil)
+}
+
+func (j *downloadJob) finish(state string, err error) {
+	status := j.snapshot(state, err)
+	if state == jobCompleted {
+		output := j.output
+		status.Output = &output
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.state = state
+	j.ended = time.Now()
+	j.final = &status
+	j.output.Mb = storage.MemoryBuf{}
+	log.Printf("download job %s %s, err: %v", j.id, state, err)
+	time.AfterFunc(jobRetention, func() {
+		downloadJobs.remove(j.id)
+	})
+}
+
+func (j *downloadJob) State() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state
+}
+
+// Status 返回任务的当前状态
+func (j *downloadJob) Status() downloadJobStatus {
+	j.mu.Lock()
+	final := j.final
+	j.mu.Unlock()
+	if final != nil {
+		return *final
+	}
+	return j.snapshot(jobRunning, nil)
+}
+
+// 基于PieceStateRuns/Stats统计下载进度
+func (j *downloadJob) snapshot(state string, err error) downloadJobStatus {
+	status := downloadJobStatus{
+		ID:       j.id,
+		InfoHash: j.ih.HexString(),
+		Name:     j.t.Name(),
+		Storage:  j.method,
+		State:    state,
+		Started:  j.started,
+		Elapsed:  time.Since(j.started).Seconds(),
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	if j.t.Info() != nil {
+		status.NumPieces = j.t.NumPieces()
+		status.PiecesCompleted, status.PiecesPartial = utils.CountPieces(j.t.PieceStateRuns())
+		status.BytesCompleted = j.t.BytesCompleted()
+		status.Length = j.t.Length()
+	}
+	stats := j.t.Stats()
+	if status.Elapsed > 0 {
+		status.Rate = int64(float64(stats.BytesReadUsefulData.Int64()) / status.Elapsed)
+	}
+	status.ActivePeers = stats.ActivePeers
+	status.TotalPeers = stats.TotalPeers
+	return status
+}
+
+// Cancel 停止下载并卸载torrent
+func (j *downloadJob) Cancel() {
+	if j.State() != jobRunning {
+		return
+	}
+	j.cancel()
+	<-j.done
+	dropTorrent(j.ih)
+}
+
+func logDownloadStats(cl *torrent.Client, started time.Time) {
+	utils.OutputStats(cl)
+	clientConnStats := cl.ConnStats()
+	log.Printf("average download rate: %v",
+		humanize.Bytes(
+			uint64(
+				time.Duration(
+					clientConnStats.BytesReadUsefulData.Int64(),
+				)*time.Second/time.Since(started),
+			),
+		),
+	)
+
+	spew.Dump(expvar.Get("torrent").(*expvar.Map).Get("chunks received"))
+	spew.Dump(cl.ConnStats())
+	clStats := cl.ConnStats()
+	sentOverhead := clStats.BytesWritten.Int64() - clStats.BytesWrittenData.Int64()
+	log.Printf(
+		"client read %v, %.1f%% was useful data. sent %v non-data bytes",
+		humanize.Bytes(uint64(clStats.BytesRead.Int64())),
+		100*float64(clStats.BytesReadUsefulData.Int64())/float64(clStats.BytesRead.Int64()),
+		humanize.Bytes(uint64(sentOverhead)),
+	)
+}
+
+// 查询下载任务
+
+// - 名称：list_jobs
+// - 方法：GET
+// - 输出：所有任务的状态(不包括下载结果)
+
+func list_jobs(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
+	jobs := downloadJobs.list()
+	statuses := make([]downloadJobStatus, 0, len(jobs))
+	for _, j := range jobs {
+		status := j.Status()
+		status.Output = nil
+		statuses = append(statuses, status)
+	}
+	writeJobJson(w, r, "list_jobs", statuses)
+}
+
+// - 名称：get_job
+// - 输入：id(query)
+// - 输出：任务的状态, 完成后包括下载结果(memory存储方式的数据保留到任务被删除)
+
+func get_job(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
+	j, ok := jobFromRequest(w, r, "get_job")
+	if !ok {
+		return
+	}
+	writeJobJson(w, r, "get_job", j.Status())
+}
+
+// - 名称：wait_job
+// - 输入：id(query), timeout(query, 秒, 为空时一直等待)
+// - 输出：任务结束或超时时的状态
+
+func wait_job(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
+	j, ok := jobFromRequest(w, r, "wait_job")
+	if !ok {
+		return
+	}
+	var timeout <-chan time.Time
+	if s := r.URL.Query().Get("timeout"); s != "" {
+		seconds, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			log.Printf("wait_job parse timeout error: %v", err)
+			http.Error(w, fmt.Sprintf("Invalid timeout %q", s), http.StatusBadRequest)
+			return
+		}
+		timer := time.NewTimer(time.Duration(seconds * float64(time.Second)))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-j.done:
+	case <-timeout:
+		log.Printf("wait_job %s timeout", j.id)
+	case <-r.Context().Done():
+		return
+	}
+	writeJobJson(w, r, "wait_job", j.Status())
+}
+
+// - 名称：cancel_job
+// - 输入：id(query)
+// - 方法：POST
+// - 输出：取消后的状态
+
+func cancel_job(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
+	if r.Method != "POST" {
+		log.Printf("Invalid request method %s", r.Method)
+		http.Error(w, fmt.Sprintf("Invalid request method %s", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	j, ok := jobFromRequest(w, r, "cancel_job")
+	if !ok {
+		return
+	}
+	j.Cancel()
+	writeJobJson(w, r, "cancel_job", j.Status())
+}
+
+func jobFromRequest(w http.ResponseWriter, r *http.Request, name string) (*downloadJob, bool) {
+	id := r.URL.Query().Get("id")
+	j, ok := downloadJobs.get(id)
+	if !ok {
+		log.Printf("%s job %q not found", name, id)
+		http.Error(w, fmt.Sprintf("Job %q not found", id), http.StatusNotFound)
+		return nil, false
+	}
+	return j, true
+}
+
+func writeJobJson(w http.ResponseWriter, r *http.Request, name string, v interface{}) {
+	outputJson, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("%s json marshal error: %v", name, err)
+		http.Error(w, "Json marshal job status failed", http.StatusInternalServerError)
+		return
+	}
+	n, err := w.Write(outputJson)
+	if err != nil {
+		log.Printf("%s write output to %s error: %v", name, r.RemoteAddr, err)
+		return
+	}
+	log.Printf("%s write %d bytes output to %s ok", name, n, r.RemoteAddr)
+}
+
+// 下载结果中的路径, memory存储方法在任务完成后才有数据
+// 多文件torrent的path是目录, files中是每个文件的路径
+func downloadOutput(method string, mi *metainfo.MetaInfo, info *metainfo.Info) startDownloadingOutput {
+	var output startDownloadingOutput
+	output.Storage = method
+	if method != "memory" {
+		output.Path = torrentDataPath(method, mi.HashInfoBytes(), info)
+	}
+	if info.IsDir() {
+		output.Files = infoFiles(method, mi.HashInfoBytes(), info)
+	}
+	return output
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// 按tensor对齐的torrent(safetensors)
+// 默认把模型文件作为一个整体制作torrent, piece的边界会切开tensor
+// layout为tensor时重新排列safetensors文件, 使每个tensor(或几个小tensor组成的组)从piece的边界开始:
+// - header用空格填充, 数据部分从piece的边界开始
+// - 连续的tensor组成一组, 组的大小达到piece length(或遇到大于piece length的tensor)时结束,
+//   组之间插入__pad_<n>__(U8)填充到piece的边界, safetensors要求数据部分没有空洞
+// - 同时生成tensor到piece范围的索引, 通过get_tensor_index获取, 并与.torrent文件保存在一起
+// client可以只下载需要的层, 先到达的层可以先开始推理或训练
+
+const layoutTensor = "tensor"
+
+// 填充用的tensor名称前缀, 聚合时忽略
+const safetensorsPadPrefix = "__pad_"
+
+type tensorIndexEntry struct {
+	Name   string   `json:"name"`
+	Dtype  string   `json:"dtype"`
+	Shape  []int64  `json:"shape"`
+	Group  int      `json:"group"`
+	Offset int64    `json:"offset"` // 在文件中的位置
+	Length int64    `json:"length"`
+	Pieces [2]int64 `json:"pieces"` // piece范围[begin, end)
+}
+
+type tensorIndex struct {
+	InfoHash    string             `json:"infohash"`
+	Name        string             `json:"name"`
+	PieceLength int64              `json:"piece_length"`
+	NumPieces   int                `json:"num_pieces"`
+	HeaderLen   int64              `json:"header_length"` // header占用的字节数, 包括开头的8字节, 总是piece length的整数倍
+	Tensors     []tensorIndexEntry `json:"tensors"`
+}
+
+var tensorIndexesMu sync.Mutex
+var tensorIndexes = make(map[metainfo.Hash]*tensorIndex)
+
+func checkLayout(layout string) error {
+	if layout != "" && layout != layoutTensor {
+		return fmt.Errorf("unknown layout %q", layout)
+	}
+	return nil
+}
+
+// 对齐后的文件名, 避免覆盖原来的文件
+func alignedName(name string) string {
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + ".aligned" + ext
+}
+
+// 重新排列safetensors, 返回对齐后的数据和tensor索引(不包括infohash)
+func alignSafetensors(data []byte, pieceLength int64) ([]byte, *tensorIndex, error) {
+	names, entries, metadata, dataStart, err := parseSafetensorsHeader(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pieceLength <= 0 {
+		pieceLength = metainfo.ChoosePieceLength(int64(len(data)))
+	}
+
+	// 数据部分的布局, 偏移相对于数据部分的开头
+	header := make(map[string]interface{})
+	index := &tensorIndex{PieceLength: pieceLength}
+	var off, groupStart int64
+	group, numPads := 0, 0
+	closeGroup := func() {
+		if off > groupStart && off%pieceLength != 0 {
+			pad := pieceLength - off%pieceLength
+			header[fmt.Sprintf("%s%d__", safetensorsPadPrefix, numPads)] = safetensorsEntry{
+				Dtype:       "U8",
+				Shape:       []int64{pad},
+				DataOffsets: [2]int64{off, off + pad},
+			}
+			numPads++
+			off += pad
+		}
+		if off > groupStart {
+			group++
+		}
+		groupStart = off
+	}
+	type move struct{ from, to, length int64 }
+	var moves []move
+	for _, name := range names {
+		if strings.HasPrefix(name, safetensorsPadPrefix) {
+			// 已经对齐过的文件, 重新计算填充
+			continue
+		}
+		e := entries[name]
+		length := e.DataOffsets[1] - e.DataOffsets[0]
+		if length < 0 || dataStart+e.DataOffsets[1] > int64(len(data)) {
+			return nil, nil, fmt.Errorf("safetensors tensor %s data offsets %v out of range", name, e.DataOffsets)
+		}
+		if off-groupStart >= pieceLength || (length >= pieceLength && off > groupStart) {
+			closeGroup()
+		}
+		header[name] = safetensorsEntry{
+			Dtype:       e.Dtype,
+			Shape:       e.Shape,
+			DataOffsets: [2]int64{off, off + length},
+		}
+		moves = append(moves, move{dataStart + e.DataOffsets[0], off, length})
+		index.Tensors = append(index.Tensors, tensorIndexEntry{
+			Name:   name,
+			Dtype:  e.Dtype,
+			Shape:  e.Shape,
+			Group:  group,
+			Offset: off,
+			Length: length,
+		})
+		off += length
+	}
+	if len(metadata) > 0 {
+		header["__metadata__"] = metadata
+	}
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return nil, nil, err
+	}
+	// header用空格填充到piece的边界
+	headerLen := int64(8 + len(headerBytes))
+	if headerLen%pieceLength != 0 {
+		headerLen += pieceLength - headerLen%pieceLength
+	}
+
+	ret := make([]byte, headerLen+off)
+	binary.LittleEndian.PutUint64(ret, uint64(headerLen-8))
+	copy(ret[8:], headerBytes)
+	for i := 8 + int64(len(headerBytes)); i < headerLen; i++ {
+		ret[i] = ' '
+	}
+	for _, m := range moves {
+		copy(ret[headerLen+m.to:], data[m.from:m.from+m.length])
+	}
+
+	index.HeaderLen = headerLen
+	index.NumPieces = int((int64(len(ret)) + pieceLength - 1) / pieceLength)
+	for i := range index.Tensors {
+		t := &index.Tensors[i]
+		t.Offset += headerLen
+		t.Pieces = [2]int64{t.Offset / pieceLength, (t.Offset + t.Length + pieceLength - 1) / pieceLength}
+	}
+	return ret, index, nil
+}
+
+func setTensorIndex(ih metainfo.Hash, index *tensorIndex) {
+	tensorIndexesMu.Lock()
+	defer tensorIndexesMu.Unlock()
+	tensorIndexes[ih] = index
+}
+
+func getTensorIndex(ih metainfo.Hash) (*tensorIndex, bool) {
+	tensorIndexesMu.Lock()
+	defer tensorIndexesMu.Unlock()
+	index, ok := tensorIndexes[ih]
+	return index, ok
+}
+
+// 读取create_torrent的输入数据, 返回数据和torrent中的文件名
+func readTorrentInput(method string, input *createTorrentInput) ([]byte, string, error) {
+	if method == "memory" {
+		if len(input.Mb.Data) == 0 {
+			return nil, "", fmt.Errorf("empty data")
+		}
+		return input.Mb.Data, "from memory", nil
+	}
+	err := checkInStorageDir(method, input.Path)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := os.ReadFile(input.Path)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, filepath.Base(input.Path), nil
+}
+
+// 登记torrent的数据, memory保存在memoryManager中, tmpfs/disk写入存储目录
+func putTorrentData(method string, mip *metainfo.MetaInfo, data []byte) error {
+	ih := mip.HashInfoBytes()
+	if method == "memory" {
+		// 登记数据, 在start_seeding时创建client
+		memoryTorrents.put(ih, &storage.MemoryBuf{
+			Data:   data,
+			Length: int64(len(data)),
+		})
+	} else {
+		info, err := mip.UnmarshalInfo()
+		if err != nil {
+			return err
+		}
+		err = writeModelParam(torrentDataPath(method, ih, &info), data)
+		if err != nil {
+			return err
+		}
+	}
+	setTorrentMethod(ih, method)
+	return nil
+}
+
+// create_torrent指定layout为tensor时, 制作按tensor对齐的torrent
+func createTensorTorrent(method string, input *createTorrentInput) (*metainfo.MetaInfo, error) {
+	data, name, err := readTorrentInput(method, input)
+	if err != nil {
+		return nil, err
+	}
+	pieceLength, how := choosePieceLength(input.PieceLength, int64(len(data)))
+	aligned, index, err := alignSafetensors(data, pieceLength)
+	if err != nil {
+		return nil, err
+	}
+	info := metainfo.Info{PieceLength: index.PieceLength}
+	err = buildInfoFromMemory(&info, aligned, alignedName(name))
+	if err != nil {
+		return nil, err
+	}
+	mip := newMetaInfo(&info)
+	mip.Comment = pieceLengthComment(pieceLength, how)
+	setTrackers(mip, input.Trackers)
+	err = putTorrentData(method, mip, aligned)
+	if err != nil {
+		return nil, err
+	}
+	ih := mip.HashInfoBytes()
+	index.InfoHash = ih.HexString()
+	index.Name = info.Name
+	setTensorIndex(ih, index)
+	log.Printf("tensor layout %s: %d tensors, %d pieces of %d bytes, %d -> %d bytes",
+		index.InfoHash, len(index.Tensors), index.NumPieces, index.PieceLength, len(data), len(aligned))
+	return mip, nil
+}
+
+// 与.torrent文件保存在一起
+func writeTensorIndexToFile(ih metainfo.Hash, path string) error {
+	index, ok := getTensorIndex(ih)
+	if !ok {
+		return nil
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o640)
+}
+
+// 获取tensor到piece范围的索引
+// - 名称：get_tensor_index
+// - 输入：infohash(query)
+// - 方法：GET
+// - 输出：索引(json), 只有layout为tensor的torrent才有
+
+func get_tensor_index(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
+	var ih metainfo.Hash
+	err := ih.FromHexString(r.URL.Query().Get("infohash"))
+	if err != nil {
+		log.Printf("get_tensor_index parse infohash error: %v", err)
+		http.Error(w, fmt.Sprintf("Invalid infohash: %v", err), http.StatusBadRequest)
+		return
+	}
+	index, ok := getTensorIndex(ih)
+	if !ok {
+		http.Error(w, "Tensor index not found", http.StatusNotFound)
+		return
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		log.Printf("get_tensor_index json marshal error: %v", err)
+		http.Error(w, "Json marshal tensor index failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// 用infohash或magnet代替完整的torrent
+// start_seeding/stop_seeding/get_torrent_status/start_downloading的请求可以是:
+// - bencode编码的torrent(可以额外携带storage/files/ranges/peers)
+// - infohash(40位hex)或magnet文本
+// - json: {"infohash"或"magnet", "storage", "files", "ranges", "peers"}
+// - 空的body, 在query中指定infohash或magnet(以及storage)
+// 只有infohash时从本地(client中的torrent或registry中的版本)获取metainfo,
+// start_downloading在本地没有时通过IPList/tracker/magnet中的peer获取
+// create_torrent在X-Magnet-Uri中返回magnet
+
+const fetchMetaInfoTimeout = 2 * time.Minute
+
+type torrentRefInput struct {
+	InfoHash string    `json:"infohash,omitempty"`
+	Magnet   string    `json:"magnet,omitempty"`
+	Storage  string    `json:"storage,omitempty"`
+	Files    []string  `json:"files,omitempty"`
+	Ranges   [][]int64 `json:"ranges,omitempty"`
+	Peers    []string  `json:"peers,omitempty"`
+}
+
+// 请求中的torrent
+type torrentRequest struct {
+	ih       metainfo.Hash
+	mi       *metainfo.MetaInfo // 请求中只有infohash/magnet时为nil
+	name     string             // magnet中的dn
+	trackers []string           // magnet中的tr
+	storage  string
+	sel      *downloadSelection
+	peers    []string
+}
+
+func readTorrentRequest(r *http.Request) (*torrentRequest, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read data: %w", err)
+	}
+	if len(body) > 0 && body[0] == 'd' {
+		return bdecodeTorrentRequest(body)
+	}
+
+	var input torrentRefInput
+	text := strings.TrimSpace(string(body))
+	if strings.HasPrefix(text, "{") {
+		err = json.Unmarshal(body, &input)
+		if err != nil {
+			return nil, fmt.Errorf("json unmarshal: %w", err)
+		}
+	} else if strings.HasPrefix(text, "magnet:") {
+		input.Magnet = text
+	} else {
+		input.InfoHash = text
+	}
+	q := r.URL.Query()
+	if input.InfoHash == "" && input.Magnet == "" {
+		input.InfoHash = q.Get("infohash")
+		input.Magnet = q.Get("magnet")
+	}
+	if input.Storage == "" {
+		input.Storage = q.Get("storage")
+	}
+	return input.request()
+}
+
+// 由infohash或magnet构造请求, http和grpc共用
+func (input *torrentRefInput) request() (*torrentRequest, error) {
+	req := &torrentRequest{
+		storage: input.Storage,
+		peers:   input.Peers,
+	}
+	if len(input.Files) != 0 || len(input.Ranges) != 0 {
+		req.sel = &downloadSelection{Files: input.Files, Ranges: input.Ranges}
+	}
+	if input.Magnet != "" {
+		m, err := metainfo.ParseMagnetUri(input.Magnet)
+		if err != nil {
+			return nil, fmt.Errorf("parse magnet: %w", err)
+		}
+		req.ih = m.InfoHash
+		req.name = m.DisplayName
+		req.trackers = m.Trackers
+		req.peers = append(req.peers, m.Params["x.pe"]...)
+	} else if input.InfoHash != "" {
+		err := req.ih.FromHexString(input.InfoHash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid infohash %q: %w", input.InfoHash, err)
+		}
+	} else {
+		return nil, fmt.Errorf("no torrent, infohash or magnet in request")
+	}
+	err := checkPeers(req.peers)
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func bdecodeTorrentRequest(body []byte) (*torrentRequest, error) {
+	var mi metainfo.MetaInfo
+	err := bencode.NewDecoder(bytes.NewBuffer(body)).Decode(&mi)
+	if err != nil {
+		return nil, fmt.Errorf("bdecode torrent: %w", err)
+	}
+	req := &torrentRequest{
+		ih:      mi.HashInfoBytes(),
+		mi:      &mi,
+		storage: bdecodeStorageMethod(body),
+	}
+	req.sel, err = bdecodeSelection(body)
+	if err != nil {
+		return nil, err
+	}
+	req.peers, err = bdecodePeers(body)
+	if err != nil {
+		return nil, err
+	}
+	err = checkPeers(req.peers)
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// 请求中的metainfo, 只有infohash时从本地获取, fetch为true时本地没有则从peer获取
+func (req *torrentRequest) metaInfo(ctx context.Context, method string, fetch bool) (*metainfo.MetaInfo, error) {
+	if req.mi != nil {
+		return req.mi, nil
+	}
+	if mip := localMetaInfo(req.ih); mip != nil {
+		req.mi = mip
+		return mip, nil
+	}
+	if !fetch {
+		return nil, fmt.Errorf("torrent %s not found", req.ih.HexString())
+	}
+	mip, err := fetchMetaInfo(ctx, req, method)
+	if err != nil {
+		return nil, err
+	}
+	req.mi = mip
+	return mip, nil
+}
+
+// client中已经有info的torrent, 或者registry中登记的版本
+func localMetaInfo(ih metainfo.Hash) *metainfo.MetaInfo {
+	if t, _, ok := findTorrent(ih); ok && t.Info() != nil {
+		mi := t.Metainfo()
+		return &mi
+	}
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for _, versions := range registry.models {
+		for _, v := range versions {
+			if v.mi != nil && v.mi.HashInfoBytes() == ih {
+				return v.mi
+			}
+		}
+	}
+	return nil
+}
+
+// 通过peer获取info(BEP 9)
+// torrent由torrentClient管理, memory存储方式获取info后卸载, 再交给memoryManager
+func fetchMetaInfo(ctx context.Context, req *torrentRequest, method string) (*metainfo.MetaInfo, error) {
+	s, ok := storages[method]
+	if !ok {
+		s = storages["tmpfs"]
+	}
+	t, isNew := torrentClient.AddTorrentInfoHashWithStorage(req.ih, s)
+	if isNew && method != "memory" {
+		setTorrentMethod(req.ih, method)
+	}
+	trackers := configTrackers()
+	if len(req.trackers) > 0 {
+		trackers = [][]string{req.trackers}
+	}
+	t.AddTrackers(trackers)
+	if req.name != "" {
+		t.SetDisplayName(req.name)
+	}
+	addBootstrapPeers(t, method)
+	addPeers(t, req.peers, method)
+
+	log.Printf("fetching metainfo of %s from peers", req.ih.HexString())
+	ctx, cancel := context.WithTimeout(ctx, fetchMetaInfoTimeout)
+	defer cancel()
+	select {
+	case <-t.GotInfo():
+	case <-ctx.Done():
+		if isNew {
+			t.Drop()
+			deleteTorrentMethod(req.ih)
+		}
+		return nil, fmt.Errorf("fetch metainfo of %s: %w", req.ih.HexString(), ctx.Err())
+	}
+	mi := t.Metainfo()
+	if isNew && method == "memory" {
+		t.Drop()
+	}
+	log.Printf("fetched metainfo of %s from peers", req.ih.HexString())
+	return &mi, nil
+}
+
+// torrent的magnet, 带上server的地址(x.pe), 没有tracker时也可以获取metainfo
+// 端口为本机上这个torrent实际监听的端口, memory存储方式下不是DataPort
+func magnetURI(mip *metainfo.MetaInfo) string {
+	ih := mip.HashInfoBytes()
+	var infop *metainfo.Info
+	info, err := mip.UnmarshalInfo()
+	if err == nil {
+		infop = &info
+	}
+	m := mip.Magnet(&ih, infop)
+	if configStruct != nil && configStruct.Server.ServerIP != "" {
+		m.Params.Add("x.pe", net.JoinHostPort(configStruct.Server.ServerIP, strconv.Itoa(localPeerPort(ih))))
+	}
+	return m.String()
+}
@@ -1,14 +1,10 @@
 package main
 
 import (
-	"bytes"
-	"context"
 	"encoding/json"
-	"expvar"
 	"flag"
 	"fmt"
 	"io"
-	"main/utils"
 	"net/http"
 	"os"
 	"os/signal"
@@ -17,30 +13,24 @@ import (
 	"strings"
 	"sync"
 	"syscall"
-	"time"
 
 	"github.com/anacrolix/log"
 	"github.com/anacrolix/torrent"
-	"github.com/anacrolix/torrent/bencode"
 	"github.com/anacrolix/torrent/config"
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/anacrolix/torrent/storage"
-	"github.com/davecgh/go-spew/spew"
-	"github.com/dustin/go-humanize"
 )
 
 var debugFlag *bool
 
 var data []byte
-var startTime time.Time
-var sendTimes int // 完成发送的次数
-var recvTimes int // 完成接收的次数
-var mutex sync.Mutex
+var mutex sync.Mutex // 保护data和mi
 var torrentURL string
 var mi *metainfo.MetaInfo
 var configStruct *config.Config
-var storageMethod string          // 存储方法
-var torrentClient *torrent.Client // 管理所有torrent的client
+var storageMethod string          // 默认的存储方法, 请求中可以指定其它的存储方法
+var torrentClient *torrent.Client // tmpfs/disk共用的client, 管理所有torrent
+var memoryTorrents *memoryManager // memory存储方式下, 管理每个torrent的client
 
 func accessLog(r *http.Request) {
 	log.Printf("%s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
@@ -55,19 +45,76 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
 func handleSend(w http.ResponseWriter, r *http.Request) {
 	log.Printf("%s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
 	var err error
-	// 从收到第一个send开始计时
-	if startTime.IsZero() {
-		startTime = time.Now()
-		log.Print("start timer")
+	// 记录到当前轮次, 从收到第一个send开始计时
+	// after: 多级聚合中回传后获取下一轮的模型, 见hierarchy.go
+	client, number, err := roundRequest(r)
+	after := 0
+	if err == nil {
+		after, err = queryRoundNumber(r, "after")
 	}
+	if err == nil {
+		number, err = rounds.requested(client, number, after)
+	}
+	if err != nil {
+		log.Printf("send to %s error: %v", r.RemoteAddr, err)
+		writeRoundError(w, err)
+		return
+	}
+	// client之后的completesend/recv带上这个id
+	setClientIDHeader(w, client)
+	w.Header().Set(roundHeader, strconv.Itoa(number))
 
+	// 指定版本时直接返回登记的torrent
+	if version := r.URL.Query().Get("version"); version != "" {
+		v, ok := registry.lookup(configStruct.Model.ModelName, version)
+		if !ok {
+			log.Printf("send to %s error: model version %s not found", r.RemoteAddr, version)
+			http.Error(w, "Model version not found", http.StatusNotFound)
+			return
+		}
+		err = v.mi.Write(w)
+		if err != nil {
+			log.Printf("send .torrent to %s error:%v", r.RemoteAddr, err)
+			return
+		}
+		log.Printf("send .torrent version %s to %s ok", v.Version, r.RemoteAddr)
+		return
+	}
+
+	// 多级聚合: 从上一级server获取torrent并在本地做种
+	if hasParent() {
+		status, err := prepareParentModel()
+		if err != nil {
+			log.Printf("prepareParentModel: %v", err)
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	// 模型文件在制作torrent之后被修改过, 重新读取并制作新的版本
+	if mi != nil && modelFileChangedLocked() {
+		newData, err := readModelParam(modelParamPath())
+		if err != nil {
+			log.Printf("reload changed model %s error: %v", modelParamPath(), err)
+		} else {
+			log.Printf("model %s changed, reload %d bytes", modelParamPath(), len(newData))
+			invalidateCurrentModelLocked()
+			data = newData
+		}
+	}
 	// 还没有生成.torrent
 	// create torrent from memory and seed
 	if mi == nil {
 		// memory, tmpfs, disk
 		method := strings.ToLower(configStruct.Storage.Method)
-		if method == "memory" {
-			mi, err = fromMemory(data)
+		if hasParent() {
+			// prepareParentModel之后被其它请求重置(比如开启了新的一轮), 不在mutex中访问上一级
+			http.Error(w, "Model from parent is not ready, retry later", http.StatusServiceUnavailable)
+			return
+		} else if method == "memory" {
+			mi, err = fromMemory(data, buildOptions{})
 			info, err := infoBytesToInfo(mi.InfoBytes)
 			if err != nil {
 				log.Printf("infoBytesToInfo: %v", err)
@@ -79,10 +126,12 @@ func handleSend(w http.ResponseWriter, r *http.Request) {
 				Data:   data,
 				Length: totalLength,
 			}
-			seed(mi, mb)
+			err = seed(mi, mb)
+			if err != nil {
+				log.Printf("seed: %v", err)
+			}
 		} else if method == "tmpfs" {
-			modleParamPath := path.Join(configStruct.Model.ModelPath, configStruct.Model.ModelName)
-			mi, err = fromTMPFS(modleParamPath) // 修改全局变量mi
+			mi, err = fromTMPFS(modelParamPath(), buildOptions{}) // 修改全局变量mi
 			if err != nil {
 				log.Printf("fromTMPFSFilePath: %v", err)
 			}
@@ -107,10 +156,35 @@ func handleSend(w http.ResponseWriter, r *http.Request) {
 				log.Printf("seedFromTMPFS ok")
 			}
 		} else if method == "disk" {
+			mi, err = fromDisk(modelParamPath(), buildOptions{}) // 修改全局变量mi
+			if err != nil {
+				log.Printf("fromDisk: %v", err)
+				http.Error(w, fmt.Sprintf("fromDisk error: %v", err), http.StatusInternalServerError)
+				return
+			}
+			log.Printf("build MetaInfo and set all the fields")
+			pprintMetainfo(mi, pprintMetainfoFlags{
+				JustName:    false,
+				PieceHashes: false,
+				Files:       false,
+			})
 
+			err = seedFromDisk(mi)
+			if err != nil {
+				log.Printf("seedFromDisk: %v", err)
+			} else {
+				log.Printf("seedFromDisk ok")
+			}
 		} else {
 
 		}
+		// 登记为新的版本
+		if mi != nil {
+			err = publishCurrentModelLocked(method)
+			if err != nil {
+				log.Printf("publish model %s error: %v", configStruct.Model.ModelName, err)
+			}
+		}
 	}
 
 	err = mi.Write(w)
@@ -134,16 +208,28 @@ func handleRecv(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error reading request body", http.StatusInternalServerError)
 		return
 	}
-	fmt.Fprintf(w, "OK") // POST请求需要有回复
 	log.Printf("recv %d bytes from %s", len(data), r.RemoteAddr)
 
-	mutex.Lock()
-	defer mutex.Unlock()
-	recvTimes++
-	if recvTimes == configStruct.Client.TotalPeers {
-		endTime := time.Now()
-		log.Printf("PS, %s, total time: %v", configStruct.Model.ModelName, endTime.Sub(startTime))
+	// 解析回传的更新, 在本轮结束后聚合
+	u, err := parseRoundUpdate(data, r.URL.Query().Get("samples"))
+	if err != nil {
+		log.Printf("parse update from %s error: %v", r.RemoteAddr, err)
+		http.Error(w, fmt.Sprintf("Parse update failed: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// 记录到当前轮次, 所有client都回传后本轮结束
+	client, number, err := roundRequest(r)
+	if err == nil {
+		err = rounds.recv(client, number, len(data), u)
+	}
+	if err != nil {
+		log.Printf("recv from %s error: %v", r.RemoteAddr, err)
+		writeRoundError(w, err)
+		return
 	}
+	setClientIDHeader(w, client)
+	fmt.Fprintf(w, "OK") // POST请求需要有回复
 }
 
 // client完成接收后, 通知server
@@ -159,36 +245,78 @@ func handleCompleteSend(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error reading request body", http.StatusInternalServerError)
 		return
 	}
-	w.Write([]byte("ok")) // POST请求需要有回复
-
 	log.Printf("recv send status from %s,%s", r.RemoteAddr, string(data))
-	mutex.Lock()
-	defer mutex.Unlock()
-	sendTimes++
-	log.Printf("%s add sendTimes to %d", r.RemoteAddr, sendTimes)
+	client, number, err := roundRequest(r)
+	if err == nil {
+		err = rounds.sent(client, number)
+	}
+	if err != nil {
+		log.Printf("complete send from %s error: %v", r.RemoteAddr, err)
+		writeRoundError(w, err)
+		return
+	}
+	setClientIDHeader(w, client)
+	w.Write([]byte("ok")) // POST请求需要有回复
 }
 
-// 获取完成向client发送的次数
+// 获取当前轮次完成向client发送的次数
 func handleGetSendTimes(w http.ResponseWriter, r *http.Request) {
-	mutex.Lock()
-	defer mutex.Unlock()
-	w.Write([]byte(strconv.Itoa(sendTimes)))
+	w.Write([]byte(strconv.Itoa(rounds.sendTimes())))
 }
 
 // 制作torrent文件
 // - 名称：create_torrent
 // - 输入：数据
 //   - memory：pointer
-//   - tmpfs：path
-//   - disk：path
+//   - tmpfs：path, 文件或目录
+//   - disk：path, 文件或目录
 // - 方法：POST
-// - 输出：torrent
+// - 输出：torrent, magnet在X-Magnet-Uri中
 
 // if stored in memory, data is not None
 // if stored in tmpfs or disk, path is not None
+// storage为空时使用config中的Storage.Method
+// base为上一个版本的infohash时, 制作只包含变化部分的delta torrent, base必须在本地做种
+// layout为tensor时, 按tensor对齐safetensors文件, 并生成tensor到piece范围的索引
+// path为目录时制作多文件torrent, files指定其中的文件及其顺序(相对于path), 为空时包含目录中所有文件
+// piece_length为字节数或"auto", 为0时使用config中的Torrent.PieceLength
 type createTorrentInput struct {
-	Mb   storage.MemoryBuf `json:"mb"`
-	Path string            `json:"path"`
+	Mb          storage.MemoryBuf `json:"mb"`
+	Path        string            `json:"path"`
+	Storage     string            `json:"storage,omitempty"`
+	Base        string            `json:"base,omitempty"`
+	Layout      string            `json:"layout,omitempty"`
+	Files       []string          `json:"files,omitempty"`
+	PieceLength pieceLengthOption `json:"piece_length,omitempty"`
+	Trackers    [][]string        `json:"trackers"` // 为null或不指定时使用config中的tracker, []表示不使用tracker
+}
+
+// 检查与存储方法相关的输入
+func (input *createTorrentInput) check(method string) error {
+	err := checkLayout(input.Layout)
+	if err != nil {
+		return err
+	}
+	err = input.PieceLength.check()
+	if err != nil {
+		return err
+	}
+	err = checkTrackers(input.Trackers)
+	if err != nil {
+		return err
+	}
+	if method == "memory" && len(input.Files) != 0 {
+		return fmt.Errorf("multi-file torrent is not supported by memory storage")
+	}
+	return nil
+}
+
+func (input *createTorrentInput) buildOptions() buildOptions {
+	return buildOptions{
+		Files:       input.Files,
+		PieceLength: input.PieceLength,
+		Trackers:    input.Trackers,
+	}
 }
 
 func create_torrent(w http.ResponseWriter, r *http.Request) {
@@ -218,34 +346,28 @@ func create_torrent(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("create_torrent json unmarshal ok: %v", input)
 
-	if storageMethod == "memory" {
-
-	} else if storageMethod == "tmpfs" {
-		mip, err := fromTMPFS(input.Path)
-		if err != nil {
-			log.Printf("create_torrent from tmpfs path error: %v", err)
-			http.Error(w, fmt.Sprintf("create_torrent from tmpfs path error: %v", err), http.StatusInternalServerError)
-			return
-		}
-		// 返回torrent
-		err = mip.Write(w)
-		if err != nil {
-			log.Printf("return torrent to %s error: %v", r.RemoteAddr, err)
-			return
-		}
-		log.Printf("create_torrent return torrent ok")
-	} else if storageMethod == "disk" {
-
-	} else {
+	mip, err := createTorrent(&input)
+	if err != nil {
+		log.Printf("create_torrent error: %v", err)
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
 
+	// 返回torrent, tensor layout的索引通过get_tensor_index获取
+	w.Header().Set("X-Magnet-Uri", magnetURI(mip))
+	err = mip.Write(w)
+	if err != nil {
+		log.Printf("return torrent to %s error: %v", r.RemoteAddr, err)
+		return
 	}
+	log.Printf("create_torrent return torrent %s ok", mip.HashInfoBytes().HexString())
 }
 
 // 做种/上传
 
 // - 名称：start_seeding
-// - 输入：torrent
-// - 输出：是否成功
+// - 输入：torrent, 或者infohash/magnet(本地已有的torrent), 见magnet.go
+// - 输出：torrent的状态(json)
 
 func start_seeding(w http.ResponseWriter, r *http.Request) {
 	log.Printf("%s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
@@ -255,46 +377,27 @@ func start_seeding(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// read data
-	metaInfoBytes, err := io.ReadAll(r.Body)
+	// torrent, 或者infohash/magnet
+	req, err := readTorrentRequest(r)
 	if err != nil {
-		log.Printf("start_seeding read data error: %v", err)
-		http.Error(w, "Read data failed", http.StatusInternalServerError)
+		log.Printf("start_seeding read torrent error: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	log.Printf("start_seeding read data ok")
+	log.Printf("start_seeding read torrent %s ok", req.ih.HexString())
 
-	// MetaInfo
-	var mi metainfo.MetaInfo
-	d := bencode.NewDecoder(bytes.NewBuffer(metaInfoBytes))
-	err = d.Decode(&mi)
+	status, err := startSeeding(r.Context(), req)
 	if err != nil {
-		log.Printf("start_seeding bdecode torrent error: %v", err)
-		http.Error(w, "Bdecode torrent failed", http.StatusInternalServerError)
-	}
-	log.Printf("start_seeding bdecode torrent ok")
-
-	// seeding
-	if storageMethod == "memory" {
-
-	} else if storageMethod == "tmpfs" {
-		err = seedFromTMPFS(&mi)
-		if err != nil {
-			log.Printf("seedFromTMPFS error: %v", err)
-			http.Error(w, fmt.Sprintf("seedFromTMPFS error: %v", err), http.StatusInternalServerError)
-			return
-		}
-		log.Printf("seedFromTMPFS ok")
-	} else if storageMethod == "disk" {
-
-	} else {
-
+		log.Printf("start_seeding error: %v", err)
+		http.Error(w, err.Error(), errorStatus(err))
+		return
 	}
+	writeAPIJson(w, http.StatusOK, status)
 }
 
 // - 停止做种
 //   - 名称：stop_seeding
-//   - 输入：torrent
+//   - 输入：torrent, 或者infohash/magnet
 //   - client与torrent
 //   - memory：一对一，需要一个专门的管理器
 //   - tmpfs：一对所有，直接卸载相应的torrent
@@ -310,57 +413,37 @@ func stop_seeding(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// read data
-	metaInfoBytes, err := io.ReadAll(r.Body)
+	// torrent, 或者infohash/magnet
+	req, err := readTorrentRequest(r)
 	if err != nil {
-		log.Printf("stop_seeding read data error: %v", err)
-		http.Error(w, "Read data failed", http.StatusInternalServerError)
+		log.Printf("stop_seeding read torrent error: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	log.Printf("stop_seeding read data ok")
-
-	// MetaInfo
-	var mi metainfo.MetaInfo
-	d := bencode.NewDecoder(bytes.NewBuffer(metaInfoBytes))
-	err = d.Decode(&mi)
-	if err != nil {
-		log.Printf("stop_seeding bdecode torrent error: %v", err)
-		http.Error(w, "Bdecode torrent failed", http.StatusInternalServerError)
-	}
-	log.Printf("stop_seeding bdecode torrent ok")
-
-	// stop seeding
-	if storageMethod == "memory" {
-
-	} else if storageMethod == "tmpfs" {
-		hib := mi.HashInfoBytes()
-		t, ok := torrentClient.Torrent(hib)
-		// if the torrent doesn't exist, return 200 is ok
-		// cause we have nothing to stop
-		if !ok {
-			log.Printf("stop_seeding finds the torrent not in the client's torrent list: %s", mi.Describe())
-			return
-		}
-		t.Drop()
-	} else if storageMethod == "disk" {
-
-	} else {
+	log.Printf("stop_seeding read torrent %s ok", req.ih.HexString())
 
+	// if the torrent doesn't exist, return 200 is ok
+	// cause we have nothing to stop
+	if !stopSeeding(req.ih) {
+		log.Printf("stop_seeding finds the torrent not in the client's torrent list: %s", req.ih.HexString())
 	}
 }
 
 // 检查种子的状态
 
 // - 名称：get_torrent_status
-// - 输入：torrent
+// - 输入：torrent, 或者infohash/magnet
 // - 输出：状态
 //   - 被加入client
 //     - 是否seeding
 //   - 未被加入client
 
 type getTorrentStatusOutput struct {
-	Exist   bool `json:"exist"`
-	Seeding bool `json:"seeding"`
+	Exist   bool   `json:"exist"`
+	Seeding bool   `json:"seeding"`
+	Storage string `json:"storage,omitempty"` // torrent使用的存储方法
+	// 内置tracker看到的swarm, tracker没有开启或没有收到announce时为空
+	Swarm *trackerSwarmStatus `json:"swarm,omitempty"`
 }
 
 func get_torrent_status(w http.ResponseWriter, r *http.Request) {
@@ -371,48 +454,17 @@ func get_torrent_status(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// read data
-	metaInfoBytes, err := io.ReadAll(r.Body)
+	// torrent, 或者infohash/magnet
+	req, err := readTorrentRequest(r)
 	if err != nil {
-		log.Printf("get_torrent_status read data error: %v", err)
-		http.Error(w, "Read data failed", http.StatusInternalServerError)
+		log.Printf("get_torrent_status read torrent error: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	log.Printf("get_torrent_status read data ok")
-
-	// MetaInfo
-	var mi metainfo.MetaInfo
-	d := bencode.NewDecoder(bytes.NewBuffer(metaInfoBytes))
-	err = d.Decode(&mi)
-	if err != nil {
-		log.Printf("get_torrent_status bdecode torrent error: %v", err)
-		http.Error(w, "Bdecode torrent failed", http.StatusInternalServerError)
-		return
-	}
-	log.Printf("get_torrent_status bdecode torrent ok")
-
-	// get status
-	var status getTorrentStatusOutput
-	if storageMethod == "memory" {
-
-	} else if storageMethod == "tmpfs" {
-		// exist
-		hib := mi.HashInfoBytes()
-		t, ok := torrentClient.Torrent(hib)
-		status.Exist = ok
-		if ok {
-			status.Seeding = t.Seeding()
-		} else {
-			status.Seeding = false
-		}
-	} else if storageMethod == "disk" {
-
-	} else {
-
-	}
+	log.Printf("get_torrent_status read torrent %s ok", req.ih.HexString())
 
 	// return status
-	statusJson, err := json.Marshal(status)
+	statusJson, err := json.Marshal(torrentStatus(req.ih))
 	if err != nil {
 		log.Printf("get_torrent_status json marshal error: %v", err)
 		http.Error(w, "Json marshal torrent status failed", http.StatusInternalServerError)
@@ -429,15 +481,21 @@ func get_torrent_status(w http.ResponseWriter, r *http.Request) {
 // 下载
 
 // - 名称：start_downloading
-// - 输入：torrent
+// - 输入：torrent, 或者infohash/magnet(本地没有时从peer获取metainfo), 可以指定peers
 // - 方法：POST
-// - 输出：下载文件的位置
-//   - memory：
+// - 输出：下载任务id和下载文件的位置, 立即返回
+//   - memory：任务完成后通过get_job/wait_job获取数据
 //   - tmpfs：下载位置
 //   - disk：下载位置
+//   - delta torrent：完成后应用到本地的base版本, 下载结果为目标版本的数据/位置, target为目标版本的infohash
+//   - 部分下载：torrent中携带files/ranges时只下载覆盖它们的piece, files为请求的文件在本地的位置
 
 type startDownloadingOutput struct {
 	createTorrentInput
+	JobID  string         `json:"job_id"`
+	Target string         `json:"target,omitempty"` // delta torrent应用后得到的目标版本的infohash
+	Files  []selectedFile `json:"files,omitempty"`  // 部分下载时请求的文件
+	Pieces [][2]int       `json:"pieces,omitempty"` // 部分下载时需要下载的piece范围[begin, end), 为nil时下载所有piece
 }
 
 func start_downloading(w http.ResponseWriter, r *http.Request) {
@@ -448,119 +506,33 @@ func start_downloading(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// read data
-	metaInfoBytes, err := io.ReadAll(r.Body)
+	// torrent, 或者infohash/magnet
+	req, err := readTorrentRequest(r)
 	if err != nil {
-		log.Printf("start_downloading read data error: %v", err)
-		http.Error(w, "Read data failed", http.StatusInternalServerError)
+		log.Printf("start_downloading read torrent error: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	log.Printf("start_downloading read data ok")
+	log.Printf("start_downloading read torrent %s ok", req.ih.HexString())
 
-	// MetaInfo
-	var mi metainfo.MetaInfo
-	d := bencode.NewDecoder(bytes.NewBuffer(metaInfoBytes))
-	err = d.Decode(&mi)
+	output, err := startDownloading(r.Context(), req)
 	if err != nil {
-		log.Printf("start_downloading bdecode torrent error: %v", err)
-		http.Error(w, "Bdecode torrent failed", http.StatusInternalServerError)
+		log.Printf("start_downloading error: %v", err)
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
-	log.Printf("start_downloading bdecode torrent ok")
-
-	// Info
-	info, err := mi.UnmarshalInfo()
+	outputJson, err := json.Marshal(output)
 	if err != nil {
-		log.Printf("start_downloading unmarshal info bytes error: %v", err)
-		http.Error(w, "Unmarshal info bytes failed", http.StatusInternalServerError)
+		log.Printf("start_downloading json marshal error: %v", err)
+		http.Error(w, "Json marshal start_downloading output failed", http.StatusInternalServerError)
 		return
 	}
-
-	// 向client中添加torrent
-	t, err := torrentClient.AddTorrent(&mi)
+	n, err := w.Write(outputJson)
 	if err != nil {
-		log.Printf("start_downloading add torrent error: %v", err)
-		http.Error(w, "start_downloading add torrent failed", http.StatusInternalServerError)
-		return
-	}
-
-	// ctx will be cancelled when os.Interrupt signal is emitted
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer cancel()
-	// create a goroutine to print the download process
-	utils.TorrentBar(t, false)
-	var wg sync.WaitGroup
-	wg.Add(1)
-	// create a goroutine to download
-	go func() {
-		defer wg.Done()
-		select {
-		case <-ctx.Done():
-			return
-		case <-t.GotInfo():
-		}
-
-		t.DownloadAll() // 只是声明哪些piece(所有)需要被下载
-		wg.Add(1)
-		go func() { // 用goroutine来检查所有的piece都已经被下载(发布/订阅模式)
-			defer wg.Done()
-			utils.WaitForPieces(ctx, t, 0, t.NumPieces())
-		}()
-	}()
-
-	started := time.Now()
-	defer utils.OutputStats(torrentClient)
-	wg.Wait()
-
-	if ctx.Err() == nil {
-		log.Print("downloaded ALL the torrents")
-	} else {
-		err = ctx.Err()
-	}
-	clientConnStats := torrentClient.ConnStats()
-	log.Printf("average download rate: %v",
-		humanize.Bytes(
-			uint64(
-				time.Duration(
-					clientConnStats.BytesReadUsefulData.Int64(),
-				)*time.Second/time.Since(started),
-			),
-		),
-	)
-
-	spew.Dump(expvar.Get("torrent").(*expvar.Map).Get("chunks received"))
-	spew.Dump(torrentClient.ConnStats())
-	clStats := torrentClient.ConnStats()
-	sentOverhead := clStats.BytesWritten.Int64() - clStats.BytesWrittenData.Int64()
-	log.Printf(
-		"client read %v, %.1f%% was useful data. sent %v non-data bytes",
-		humanize.Bytes(uint64(clStats.BytesRead.Int64())),
-		100*float64(clStats.BytesReadUsefulData.Int64())/float64(clStats.BytesRead.Int64()),
-		humanize.Bytes(uint64(sentOverhead)),
-	)
-
-	var output startDownloadingOutput
-	if storageMethod == "memory" {
-
-	} else if storageMethod == "tmpfs" {
-		output.Path = path.Join(configStruct.Model.ModelPath, info.BestName())
-		outputJson, err := json.Marshal(output)
-		if err != nil {
-			log.Printf("start_downloading json marshal error: %v", err)
-			http.Error(w, "Json marshal start_downloading output failed", http.StatusInternalServerError)
-			return
-		}
-		n, err := w.Write(outputJson)
-		if err != nil {
-			log.Printf("start_downloading write output to %s error: %v", r.RemoteAddr, err)
-			return
-		}
-		log.Printf("get_torrent_status write %d bytes output to %s ok", n, r.RemoteAddr)
-	} else if storageMethod == "disk" {
-
-	} else {
-
+		log.Printf("start_downloading write output to %s error: %v", r.RemoteAddr, err)
+		return
 	}
+	log.Printf("start_downloading write %d bytes output to %s ok", n, r.RemoteAddr)
 }
 
 func f(w http.ResponseWriter, r *http.Request) {
@@ -576,41 +548,63 @@ func f(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func httpFunc() {
-	http.HandleFunc("/status/", handleStatus)
-	http.HandleFunc("/send/", handleSend)
-	http.HandleFunc("/recv/", handleRecv)
-	http.HandleFunc("/completesend/", handleCompleteSend)
-	http.HandleFunc("/sendtimes/", handleGetSendTimes)
-
-	http.HandleFunc("/create_torrent/", create_torrent)
-	http.HandleFunc("/start_seeding/", start_seeding)
-	http.HandleFunc("/stop_seeding/", stop_seeding)
-	http.HandleFunc("/get_torrent_status/", get_torrent_status)
-	http.HandleFunc("/start_downloading/", start_downloading)
-
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", configStruct.Port.HTTPPort), nil); err != nil {
-		log.Printf("listen %d error", configStruct.Port.HTTPPort)
-	}
+// http接口的路由, 测试中也使用它
+func newServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	// /status/和webseed不需要认证, 其它接口按权限检查(auth.go)
+	mux.HandleFunc("/status/", handleStatus)
+	mux.HandleFunc("/send/", requirePermission(permClient, handleSend))
+	mux.HandleFunc("/recv/", requirePermission(permClient, handleRecv))
+	mux.HandleFunc("/recv_torrent/", requirePermission(permClient, recv_torrent))
+	mux.HandleFunc("/completesend/", requirePermission(permClient, handleCompleteSend))
+	mux.HandleFunc("/sendtimes/", requirePermission(permRead, handleGetSendTimes))
+	mux.HandleFunc("/open_round/", requirePermission(permRound, open_round))
+	mux.HandleFunc("/round_status/", requirePermission(permRead, round_status))
+
+	mux.HandleFunc("/create_torrent/", requirePermission(permCreate, create_torrent))
+	mux.HandleFunc("/start_seeding/", requirePermission(permSeed, start_seeding))
+	mux.HandleFunc("/stop_seeding/", requirePermission(permSeed, stop_seeding))
+	mux.HandleFunc("/get_torrent_status/", requirePermission(permRead, get_torrent_status))
+	mux.HandleFunc("/start_downloading/", requirePermission(permDownload, start_downloading))
+	mux.HandleFunc("/list_jobs/", requirePermission(permRead, list_jobs))
+	mux.HandleFunc("/get_job/", requirePermission(permRead, get_job))
+	mux.HandleFunc("/wait_job/", requirePermission(permRead, wait_job))
+	mux.HandleFunc("/cancel_job/", requirePermission(permDownload, cancel_job))
+	mux.HandleFunc("/progress/", requirePermission(permRead, progress))
+	mux.HandleFunc("/get_tensor_index/", requirePermission(permRead, get_tensor_index))
+	mux.HandleFunc("/publish_model/", requirePermission(permCreate, publish_model))
+	mux.HandleFunc("/list_models/", requirePermission(permRead, list_models))
+	mux.HandleFunc("/get_model/", requirePermission(permRead, get_model))
+	mux.HandleFunc("/retire_model/", requirePermission(permSeed, retire_model))
+	mux.HandleFunc("/metainfo_cache_status/", requirePermission(permRead, metainfo_cache_status))
+	mux.HandleFunc("/tracker_status/", requirePermission(permRead, tracker_status))
+	mux.HandleFunc(webSeedPrefix, webseed)
+	mux.HandleFunc(apiPrefix, serveAPI)
+	// 其它路径交给http.DefaultServeMux, 比如expvar的/debug/vars
+	mux.Handle("/", http.DefaultServeMux)
+	return mux
 }
 
-func main() {
+func httpFunc() {
+	server := &http.Server{Addr: fmt.Sprintf(":%d", configStruct.Port.HTTPPort), Handler: newServeMux(), TLSConfig: serverTLS}
 	var err error
-
-	debugFlag = flag.Bool("debug", false, "debug flag")
-	flag.Parse()
-
-	// 加载配置数据
-	jsoncFileName := "config.jsonc"
-	configStruct, err = config.LoadJsonc(jsoncFileName)
-	storageMethod = strings.ToLower(configStruct.Storage.Method)
+	if serverTLS != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
 	if err != nil {
-		fmt.Errorf("load config error: %v", err)
-		return
+		log.Printf("listen %d error: %v", configStruct.Port.HTTPPort, err)
 	}
+}
 
-	// 设置torrent.Client
-	// client config
+// 默认存储方法下模型文件的路径
+func modelParamPath() string {
+	return path.Join(storageDir(storageMethod), configStruct.Model.ModelName)
+}
+
+// torrent.Client的公共配置
+func newClientConfig() *torrent.ClientConfig {
 	clientConfig := torrent.NewDefaultClientConfig()
 	// 对于seeder, 一开始就上传
 	// 对于leecher, 下载结束后也应该继续上传, 直到手动取消
@@ -622,28 +616,62 @@ func main() {
 	clientConfig.PublicIp6 = nil // 必须设置为nil或设置为真实值, 不能为空, 否则utp会使用dht, 然后报错
 	clientConfig.PublicIp4 = nil
 	clientConfig.Debug = *debugFlag
-	if storageMethod == "memory" {
-		// 如果直接存储在内存中, 一个torrent.Client只能管理一个torrent
-	} else if storageMethod == "tmpfs" {
-		// 指定torrent data的存储路径
-		storageImplCloser := storage.NewFile(configStruct.Model.ModelPath)
-		clientConfig.DefaultStorage = storageImplCloser
+	return clientConfig
+}
 
-		// client
-		torrentClient, err = torrent.NewClient(clientConfig)
-		if err != nil {
-			log.Printf("create torrent.Client for tmpfs error: %v", err)
-			return
-		}
-		log.Printf("create torrent.Client for tmpfs")
-	} else if storageMethod == "disk" {
+// SIGINT/SIGTERM时取消所有下载任务, 等待任务结束后退出
+func handleSignals() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	s := <-sig
+	log.Printf("received %v, cancel download jobs and exit", s)
+	downloadJobs.shutdown()
+	os.Exit(0)
+}
 
-	} else {
+func main() {
+	var err error
+
+	debugFlag = flag.Bool("debug", false, "debug flag")
+	flag.Parse()
+
+	// 加载配置数据
+	jsoncFileName := "config.jsonc"
+	configStruct, err = config.LoadJsonc(jsoncFileName)
+	if err != nil {
+		log.Printf("load config error: %v", err)
+		return
+	}
+	storageMethod = strings.ToLower(configStruct.Storage.Method)
+	optionsStruct, err = loadOptions(jsoncFileName)
+	if err != nil {
+		log.Printf("load options error: %v", err)
+		return
+	}
+	err = initAuth()
+	if err != nil {
+		log.Printf("init auth error: %v", err)
+		return
+	}
+
+	if _, err = parseStorageMethod(storageMethod); err != nil {
+		log.Printf("default storage method error: %v", err)
+		return
+	}
 
+	// 设置torrent.Client
+	// - memory：一个torrent.Client只能管理一个torrent, 由memoryManager为每个torrent单独创建client
+	// - tmpfs/disk：共用一个torrent.Client, 每个torrent使用各自的storage
+	clientConfig := newClientConfig()
+	err = initStorages(clientConfig)
+	if err != nil {
+		log.Printf("init storages error: %v", err)
+		return
 	}
+	log.Printf("create torrent.Client, default storage method %s", storageMethod)
 
 	// 读取模型数据
-	modleParamPath := path.Join(configStruct.Model.ModelPath, configStruct.Model.ModelName)
+	modleParamPath := modelParamPath()
 	log.Printf("modleParamPath %s", modleParamPath)
 	data, err = readModelParam(modleParamPath)
 	if err != nil {
@@ -651,6 +679,35 @@ func main() {
 	}
 	log.Printf("read %d bytes from model %s", len(data), configStruct.Model.ModelName)
 
+	// 多级聚合需要聚合本级client回传的更新
+	if hasParent() && !optionsStruct.Aggregate.Enabled {
+		log.Printf("parent server %s configured, enable aggregation", optionsStruct.Hierarchy.Parent)
+		optionsStruct.Aggregate.Enabled = true
+	}
+
+	// 内置tracker
+	if trackerEnabled() {
+		err = startTracker()
+		if err != nil {
+			log.Printf("start tracker error: %v", err)
+			return
+		}
+	}
+
+	// grpc控制面
+	if optionsStruct.Grpc.Enabled {
+		err = startGrpc()
+		if err != nil {
+			log.Printf("start grpc error: %v", err)
+			return
+		}
+	}
+
+	// 开启第一轮
+	rounds.open(openRoundInput{})
+
+	go handleSignals()
+
 	// 启动
 	httpFunc()
 }
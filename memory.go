@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// memory存储方式下, 一个torrent.Client只能管理一个torrent
+// memoryManager为每个torrent维护一个基于storage.MemoryBuf的client
+
+type memoryTorrent struct {
+	mb     *storage.MemoryBuf
+	client *torrent.Client // 为nil时表示数据已登记, 但还没有开始做种/下载
+	t      *torrent.Torrent
+}
+
+type memoryManager struct {
+	mu       sync.Mutex
+	torrents map[metainfo.Hash]*memoryTorrent
+}
+
+func newMemoryManager() *memoryManager {
+	return &memoryManager{
+		torrents: make(map[metainfo.Hash]*memoryTorrent),
+	}
+}
+
+// put 登记torrent对应的内存数据(create_torrent), 此时还没有创建client
+func (m *memoryManager) put(ih metainfo.Hash, mb *storage.MemoryBuf) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if mt, ok := m.torrents[ih]; ok && mt.client != nil {
+		// 已经在做种, 保留原来的数据
+		return
+	}
+	m.torrents[ih] = &memoryTorrent{mb: mb}
+}
+
+// add 为mi创建一个独立的client并添加torrent
+// mb为nil时使用put登记的数据; 如果也没有登记, 则分配一块空的buffer用于下载
+func (m *memoryManager) add(mi *metainfo.MetaInfo, mb *storage.MemoryBuf) (*memoryTorrent, error) {
+	ih := mi.HashInfoBytes()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mt, ok := m.torrents[ih]
+	if ok && mt.client != nil {
+		return mt, nil
+	}
+	if mb == nil && ok {
+		mb = mt.mb
+	}
+	if mb == nil {
+		info, err := mi.UnmarshalInfo()
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal info: %w", err)
+		}
+		mb = &storage.MemoryBuf{
+			Length: info.TotalLength(),
+		}
+	}
+
+	// 基于totalLength创建storage/client
+	storageImplCloser, err := storage.NewMemory(mb.Length, &mb)
+	if err != nil {
+		return nil, fmt.Errorf("NewMemory storage: %w", err)
+	}
+	clientConfig := newClientConfig()
+	clientConfig.DefaultStorage = storageImplCloser
+	// 每个torrent都有自己的client, 不能共用DataPort, 监听由infohash决定的端口, 其它节点不需要交换端口
+	// 端口被占用时(比如与另一个torrent冲突)由系统分配, 这时只能通过tracker或magnet中的x.pe找到它
+	port := memoryPort(ih)
+	clientConfig.SetListenAddr(fmt.Sprintf(":%d", port))
+	client, err := torrent.NewClient(clientConfig)
+	if err != nil {
+		log.Printf("memory torrent %s cannot listen on port %d: %v, using a system assigned port", ih.HexString(), port, err)
+		clientConfig.SetListenAddr(":0")
+		client, err = torrent.NewClient(clientConfig)
+	}
+	if err != nil {
+		storageImplCloser.Close()
+		return nil, fmt.Errorf("NewClient: %w", err)
+	}
+
+	// 向client中添加torrent
+	t, err := client.AddTorrent(mi)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("AddTorrent: %w", err)
+	}
+	log.Printf("memory torrent %s added, listening on %v", ih.HexString(), client.ListenAddrs())
+
+	mt = &memoryTorrent{
+		mb:     mb,
+		client: client,
+		t:      t,
+	}
+	m.torrents[ih] = mt
+	return mt, nil
+}
+
+// get 返回已经创建client的torrent
+func (m *memoryManager) get(ih metainfo.Hash) (*memoryTorrent, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mt, ok := m.torrents[ih]
+	if !ok || mt.client == nil {
+		return nil, false
+	}
+	return mt, true
+}
+
+// lookup 返回登记的torrent, 包括还没有创建client的
+func (m *memoryManager) lookup(ih metainfo.Hash) (*memoryTorrent, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mt, ok := m.torrents[ih]
+	return mt, ok
+}
+
+// list 返回所有已经创建client的torrent
+func (m *memoryManager) list() []*torrent.Torrent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ts []*torrent.Torrent
+	for _, mt := range m.torrents {
+		if mt.client != nil {
+			ts = append(ts, mt.t)
+		}
+	}
+	return ts
+}
+
+// drop 卸载torrent, 关闭对应的client并释放内存数据
+func (m *memoryManager) drop(ih metainfo.Hash) bool {
+	m.mu.Lock()
+	mt, ok := m.torrents[ih]
+	delete(m.torrents, ih)
+	m.mu.Unlock()
+	if !ok {
+		return false
+	}
+	if mt.client != nil {
+		mt.t.Drop()
+		mt.client.Close()
+	}
+	return true
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// config.Config由torrent库定义, 这里补充server自己的配置项
+// 与config.Config读取同一个config.jsonc, 按字段名匹配(不区分大小写)
+type serverOptions struct {
+	Storage struct {
+		// disk存储方式下数据的存储目录, 与Model.ModelPath分开
+		DataDir string
+		// piece completion数据库所在目录, 为空时使用DataDir
+		// 重启后可以直接读取已完成的piece, 不需要重新校验
+		PieceCompletionDir string
+		// memory存储方式下每个模型保留的版本数, 更早的版本自动retire并释放内存
+		// 为0时使用默认值3, 为负数时不限制
+		MemoryVersions int
+		// memory存储方式下每个torrent单独监听的端口范围的起点和大小, 端口由infohash决定
+		// 所有节点使用相同的配置, 不需要交换端口就能找到对方; 为0时使用DataPort+1000和1000
+		MemoryPort  int
+		MemoryPorts int
+	}
+	Round struct {
+		// 每一轮的超时时间(秒), 为0时不超时
+		Timeout float64
+		// 超时后至少需要回传的client数量, 为0时需要所有client
+		MinClients int
+	}
+	Aggregate struct {
+		// 是否解析并聚合client回传的更新(FedAvg)
+		// 聚合结果作为下一次send分发的模型
+		Enabled bool
+	}
+	Torrent struct {
+		// 制作torrent时的piece length, 字节数(2的幂, 不小于16KiB)或"auto"
+		// 为0时使用torrent库的默认选择, create_torrent请求中的piece_length优先
+		PieceLength pieceLengthOption
+		// 并行计算piece hash的goroutine数量, 为0时使用CPU核数
+		HashWorkers int
+		// tmpfs/disk缓存的metainfo数量, 为0时使用默认值64, 为负数时不缓存
+		CacheEntries int
+		// 除了大小和修改时间, 是否还比较文件开头和结尾的sha1来判断文件是否变化
+		CacheFingerprint bool
+		// 写入metainfo的tracker, 每一层是一组地址(BEP 12)
+		// 不配置时使用内置tracker(Tracker.Enabled)或serve.go中的defaultTrackers, 为[]时不使用tracker
+		// create_torrent请求中的trackers优先
+		Trackers [][]string
+		// 是否在metainfo的UrlList中写入server的web seed地址(BEP 19)
+		WebSeed bool
+		// web seed地址中的host, 为空时使用Server.ServerIP, 端口为Port.HttpPort
+		WebSeedHost string
+	}
+	Tracker struct {
+		// 是否在server进程中运行tracker, http和udp监听同一个端口
+		Enabled bool
+		// tracker监听的端口, 为0时使用6969
+		Port int
+		// 写入metainfo的tracker地址中的host, 为空时使用Server.ServerIP
+		Host string
+		// client两次announce的间隔(秒), 为0时使用60
+		Interval int
+	}
+	Grpc struct {
+		// 是否开启grpc控制面, 与http接口共用service层
+		Enabled bool
+		// grpc监听的端口, 为0时使用50051
+		Port int
+		// 收发消息的最大字节数, 为0时使用1GiB
+		// CreateTorrent的data和GetJob/WaitJob的output_data包括整个模型, grpc默认的4MiB不够用
+		MaxMessageSize int
+	}
+	Hierarchy struct {
+		// 上一级server的http地址(host:port或url), 为空表示这是最上一级
+		Parent string
+		// 在上一级server中显示的名字(上一级分配的id以它开头), 为空时使用hostname
+		Name string
+		// 上一级server开启Auth时使用的bearer token
+		Token string
+		// 请求上一级server的超时(秒), 包括回传聚合结果, 为0时使用300
+		Timeout int
+	}
+	Auth struct {
+		// 是否检查控制接口的身份和权限, 为false时允许所有请求
+		Enabled bool
+		// 静态bearer token, token -> 身份
+		Tokens map[string]string
+		// 身份 -> 权限(read/download/client/create/seed/round, *为所有权限)
+		Permissions map[string][]string
+		// http和grpc的证书, 配置后使用https/TLS
+		CertFile string
+		KeyFile  string
+		// 验证client证书的CA, 配置后开启mTLS, 身份为client证书的CommonName
+		ClientCAFile string
+	}
+}
+
+var optionsStruct *serverOptions
+
+func loadOptions(jsoncFileName string) (*serverOptions, error) {
+	data, err := os.ReadFile(jsoncFileName)
+	if err != nil {
+		return nil, err
+	}
+	options := &serverOptions{}
+	err = json.Unmarshal(stripJsoncComments(data), options)
+	if err != nil {
+		return nil, err
+	}
+
+	// 默认值
+	if options.Storage.DataDir == "" {
+		options.Storage.DataDir = "./data"
+	}
+	if options.Storage.PieceCompletionDir == "" {
+		options.Storage.PieceCompletionDir = options.Storage.DataDir
+	}
+	if options.Storage.MemoryVersions == 0 {
+		options.Storage.MemoryVersions = defaultMemoryVersions
+	}
+	if options.Storage.MemoryPorts == 0 {
+		options.Storage.MemoryPorts = defaultMemoryPorts
+	}
+	if options.Storage.MemoryPorts < 0 || options.Storage.MemoryPort < 0 || options.Storage.MemoryPort+options.Storage.MemoryPorts > 65536 {
+		return nil, fmt.Errorf("invalid memory port range %d+%d", options.Storage.MemoryPort, options.Storage.MemoryPorts)
+	}
+	if options.Tracker.Port == 0 {
+		options.Tracker.Port = defaultTrackerPort
+	}
+	if options.Tracker.Interval == 0 {
+		options.Tracker.Interval = defaultTrackerInterval
+	}
+	if options.Grpc.Port == 0 {
+		options.Grpc.Port = defaultGrpcPort
+	}
+	if options.Grpc.MaxMessageSize == 0 {
+		options.Grpc.MaxMessageSize = defaultGrpcMaxMessageSize
+	}
+	if options.Hierarchy.Timeout == 0 {
+		options.Hierarchy.Timeout = defaultParentTimeout
+	}
+	err = checkAuth(options)
+	if err != nil {
+		return nil, err
+	}
+	err = checkTrackers(options.Torrent.Trackers)
+	if err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// 去掉jsonc中的//和/* */注释
+// 字符串中的内容保持不变, 比如"udp://host:port"
+func stripJsoncComments(data []byte) []byte {
+	ret := make([]byte, 0, len(data))
+	inString := false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if inString {
+			ret = append(ret, c)
+			if c == '\\' && i+1 < len(data) {
+				i++
+				ret = append(ret, data[i])
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		if c == '"' {
+			inString = true
+		} else if c == '/' && i+1 < len(data) && data[i+1] == '/' {
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			if i < len(data) {
+				ret = append(ret, '\n')
+			}
+			continue
+		} else if c == '/' && i+1 < len(data) && data[i+1] == '*' {
+			i += 2
+			for i+1 < len(data) && !(data[i] == '*' && data[i+1] == '/') {
+				i++
+			}
+			i++
+			continue
+		}
+		ret = append(ret, c)
+	}
+	return ret
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// 不依赖tracker的peer发现
+// 添加torrent时把Client.IPList中的client和ServerIP作为已知的peer加入,
+// start_downloading还可以在请求中指定peers("ip"或"ip:port"), magnet中的x.pe也会被加入
+// 没有tracker和DHT时swarm也能建立
+// peer的端口: tmpfs/disk为Port.DataPort; memory的每个torrent有自己的client,
+// 监听Storage.MemoryPort开始的端口范围中由infohash决定的端口(memoryPort), 其它节点可以算出同一个端口
+
+const (
+	defaultMemoryPortOffset = 1000 // MemoryPort为0时相对DataPort的偏移
+	defaultMemoryPorts      = 1000
+)
+
+// memory存储方式下torrent监听的端口
+// 端口范围有限, 不同torrent可能算出同一个端口, 这时后添加的torrent由系统分配端口(见memoryManager.add)
+func memoryPort(ih metainfo.Hash) int {
+	base, n := defaultMemoryPortOffset, defaultMemoryPorts
+	if configStruct != nil {
+		base += configStruct.Port.DataPort
+	}
+	if optionsStruct != nil {
+		if optionsStruct.Storage.MemoryPort != 0 {
+			base = optionsStruct.Storage.MemoryPort
+		}
+		if optionsStruct.Storage.MemoryPorts > 0 {
+			n = optionsStruct.Storage.MemoryPorts
+		}
+	}
+	return base + int(binary.BigEndian.Uint32(ih[:4])%uint32(n))
+}
+
+// 存储方法对应的peer端口
+func peerPort(ih metainfo.Hash, method string) int {
+	if method == "memory" {
+		return memoryPort(ih)
+	}
+	return configStruct.Port.DataPort
+}
+
+// 本机上torrent实际监听的端口, 用于magnet中的x.pe
+func localPeerPort(ih metainfo.Hash) int {
+	if mt, ok := memoryTorrents.get(ih); ok {
+		return mt.client.LocalPort()
+	}
+	if _, ok := memoryTorrents.lookup(ih); ok {
+		return memoryPort(ih)
+	}
+	return configStruct.Port.DataPort
+}
+
+// 解析peer地址, 没有端口时使用defaultPort
+func parsePeerAddr(s string, defaultPort int) (*net.TCPAddr, error) {
+	host, port := s, defaultPort
+	if h, p, err := net.SplitHostPort(s); err == nil {
+		host = h
+		port, err = strconv.Atoi(p)
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid peer %q: bad port", s)
+		}
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		ips, err := net.LookupIP(host)
+		if err != nil || len(ips) == 0 {
+			return nil, fmt.Errorf("invalid peer %q: %v", s, err)
+		}
+		ip = ips[0]
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+func checkPeers(peers []string) error {
+	for _, p := range peers {
+		_, err := parsePeerAddr(p, configStruct.Port.DataPort)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 本机上监听port的client, 不需要连接自己
+func isLocalPeer(addr *net.TCPAddr, port int) bool {
+	if addr.Port != port {
+		return false
+	}
+	if addr.IP.IsLoopback() || addr.IP.IsUnspecified() {
+		return true
+	}
+	ifaddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, a := range ifaddrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.Equal(addr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// config中的client和server
+func bootstrapPeerAddrs() []string {
+	if configStruct == nil {
+		return nil
+	}
+	addrs := append([]string{}, configStruct.Client.IPList...)
+	if configStruct.Server.ServerIP != "" {
+		addrs = append(addrs, configStruct.Server.ServerIP)
+	}
+	return addrs
+}
+
+// method为torrent的存储方法, 决定peer的端口
+func addBootstrapPeers(t *torrent.Torrent, method string) {
+	addPeers(t, bootstrapPeerAddrs(), method)
+}
+
+// 把peers作为已知的peer加入torrent, 无法解析的地址被忽略
+// 没有端口的peer使用method对应的端口
+func addPeers(t *torrent.Torrent, peers []string, method string) {
+	port := peerPort(t.InfoHash(), method)
+	var infos []torrent.PeerInfo
+	seen := make(map[string]bool)
+	for _, p := range peers {
+		addr, err := parsePeerAddr(p, port)
+		if err != nil {
+			log.Printf("torrent %s skip peer: %v", t.InfoHash().HexString(), err)
+			continue
+		}
+		if seen[addr.String()] || isLocalPeer(addr, port) {
+			continue
+		}
+		seen[addr.String()] = true
+		infos = append(infos, torrent.PeerInfo{
+			Addr:    addr,
+			Source:  torrent.PeerSourceDirect,
+			Trusted: true,
+		})
+	}
+	if len(infos) == 0 {
+		return
+	}
+	n := t.AddPeers(infos)
+	log.Printf("torrent %s added %d of %d known peers", t.InfoHash().HexString(), n, len(infos))
+}
+
+// bencode编码的torrent中可以额外携带peers字段, 解码MetaInfo时会被忽略
+func bdecodePeers(metaInfoBytes []byte) ([]string, error) {
+	var extra struct {
+		Peers []string `bencode:"peers,omitempty"`
+	}
+	err := bencode.NewDecoder(bytes.NewBuffer(metaInfoBytes)).Decode(&extra)
+	if err != nil {
+		return nil, fmt.Errorf("bdecode peers: %w", err)
+	}
+	return extra.Peers, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/dustin/go-humanize"
+)
+
+// piece length
+// create_torrent的piece_length和config中的Torrent.PieceLength可以是字节数或"auto"
+// 请求中的 > config中的 > torrent库的默认选择(metainfo.ChoosePieceLength)
+// auto根据总长度和Client.TotalPeers选择:
+// - 每个peer至少有autoPiecesPerPeer个piece, 保证swarm中可以并行下载不同的piece
+// - piece越大, hash和piece的消息越少, 局域网中大文件适合大的piece
+// - piece数量不超过autoMaxPieces, 控制metainfo的大小
+
+type pieceLengthOption int64
+
+const pieceLengthAuto pieceLengthOption = -1
+
+const (
+	autoMinPieceLength = 256 << 10
+	autoMaxPieceLength = 64 << 20
+	autoMinPieces      = 256
+	autoMaxPieces      = 8192 // piece hash不超过160KiB
+	autoPiecesPerPeer  = 64
+)
+
+func (p *pieceLengthOption) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		if strings.ToLower(s) != "auto" {
+			return fmt.Errorf("invalid piece length %q", s)
+		}
+		*p = pieceLengthAuto
+		return nil
+	}
+	var n int64
+	err := json.Unmarshal(data, &n)
+	if err != nil {
+		return fmt.Errorf("invalid piece length %s", data)
+	}
+	*p = pieceLengthOption(n)
+	return p.check()
+}
+
+func (p pieceLengthOption) MarshalJSON() ([]byte, error) {
+	if p == pieceLengthAuto {
+		return json.Marshal("auto")
+	}
+	return json.Marshal(int64(p))
+}
+
+// piece length必须是2的幂, 并且不小于16KiB(一个block)
+func (p pieceLengthOption) check() error {
+	if p == 0 || p == pieceLengthAuto {
+		return nil
+	}
+	if p < 1<<14 || p&(p-1) != 0 {
+		return fmt.Errorf("piece length %d must be a power of 2 and at least 16384", p)
+	}
+	return nil
+}
+
+// 确定piece length, 同时返回选择的依据
+func choosePieceLength(requested pieceLengthOption, totalLength int64) (int64, string) {
+	how := "request"
+	p := requested
+	if p == 0 {
+		how, p = "config", optionsStruct.Torrent.PieceLength
+	}
+	var pieceLength int64
+	switch p {
+	case 0:
+		how, pieceLength = "default", metainfo.ChoosePieceLength(totalLength)
+	case pieceLengthAuto:
+		peers := 0
+		if configStruct != nil {
+			peers = configStruct.Client.TotalPeers
+		}
+		pieceLength = autoPieceLength(totalLength, peers)
+		how = fmt.Sprintf("auto, %d peers", peers)
+	default:
+		pieceLength = int64(p)
+	}
+	log.Printf("piece length %s for %s (%s), %d pieces",
+		humanize.IBytes(uint64(pieceLength)), humanize.IBytes(uint64(totalLength)), how, (totalLength+pieceLength-1)/pieceLength)
+	return pieceLength, how
+}
+
+func autoPieceLength(totalLength int64, peers int) int64 {
+	pieces := int64(peers) * autoPiecesPerPeer
+	if pieces < autoMinPieces {
+		pieces = autoMinPieces
+	}
+	if pieces > autoMaxPieces {
+		pieces = autoMaxPieces
+	}
+	// 不小于totalLength/pieces的最小的2的幂
+	var pieceLength int64 = autoMinPieceLength
+	for pieceLength < autoMaxPieceLength && pieceLength*pieces < totalLength {
+		pieceLength *= 2
+	}
+	return pieceLength
+}
+
+// 记录在metainfo的comment中
+func pieceLengthComment(pieceLength int64, how string) string {
+	return fmt.Sprintf("piece length %s (%s)", humanize.IBytes(uint64(pieceLength)), how)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/utils"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// 下载进度推送(Server-Sent Events)
+
+// - 名称：progress
+// - 输入：infohash或job(query), interval(query, 秒, 默认3, 最小0.1, 最大3600)
+// - 方法：GET
+// - 输出：text/event-stream
+//   - piece：piece状态变化(SubscribePieceStateChanges)
+//   - stats：定时推送的速度和peer数量
+//   - complete：任务需要的piece下载完成(部分下载时只有选择的piece), 随后关闭连接
+
+const (
+	defaultProgressInterval = 3 * time.Second
+	minProgressInterval     = 100 * time.Millisecond
+	maxProgressInterval     = time.Hour
+)
+
+// 秒数转换为统计的间隔, 0时使用默认值, 超出范围时取最小值或最大值
+// 太小的值转换后为0, 太大的值溢出为负数, time.NewTicker都会panic
+func progressInterval(seconds float64) (time.Duration, error) {
+	if math.IsNaN(seconds) || math.IsInf(seconds, 0) || seconds < 0 {
+		return 0, fmt.Errorf("invalid interval %v", seconds)
+	}
+	if seconds == 0 {
+		return defaultProgressInterval, nil
+	}
+	if seconds >= maxProgressInterval.Seconds() {
+		return maxProgressInterval, nil
+	}
+	interval := time.Duration(seconds * float64(time.Second))
+	if interval < minProgressInterval {
+		interval = minProgressInterval
+	}
+	return interval, nil
+}
+
+type pieceEvent struct {
+	Index    int  `json:"index"`
+	Complete bool `json:"complete"`
+	Ok       bool `json:"ok"`
+	Partial  bool `json:"partial"`
+	Checking bool `json:"checking"`
+}
+
+type statsEvent struct {
+	InfoHash        string `json:"infohash"`
+	NumPieces       int    `json:"num_pieces"`
+	PiecesCompleted int    `json:"pieces_completed"`
+	PiecesPartial   int    `json:"pieces_partial"`
+	BytesCompleted  int64  `json:"bytes_completed"`
+	Length          int64  `json:"length"`
+	Rate            int64  `json:"rate"` // 最近一个interval的下载速度, Bytes/s
+	ActivePeers     int    `json:"active_peers"`
+	TotalPeers      int    `json:"total_peers"`
+}
+
+func progress(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	var ih metainfo.Hash
+	var pieces [][2]int
+	if id := r.URL.Query().Get("job"); id != "" {
+		j, ok := downloadJobs.get(id)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Job %q not found", id), http.StatusNotFound)
+			return
+		}
+		ih, pieces = j.ih, j.output.Pieces
+	} else {
+		err := ih.FromHexString(r.URL.Query().Get("infohash"))
+		if err != nil {
+			log.Printf("progress parse infohash error: %v", err)
+			http.Error(w, fmt.Sprintf("Invalid infohash: %v", err), http.StatusBadRequest)
+			return
+		}
+		pieces = downloadJobs.pieces(ih)
+	}
+	interval := defaultProgressInterval
+	if s := r.URL.Query().Get("interval"); s != "" {
+		seconds, err := strconv.ParseFloat(s, 64)
+		if err == nil && seconds <= 0 {
+			err = fmt.Errorf("interval must be positive")
+		}
+		if err == nil {
+			interval, err = progressInterval(seconds)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid interval %q", s), http.StatusBadRequest)
+			return
+		}
+	}
+
+	t, _, ok := findTorrent(ih)
+	if !ok {
+		log.Printf("progress finds the torrent not in the client's torrent list: %s", ih.HexString())
+		http.Error(w, "Torrent not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	err := watchProgress(r.Context(), t, ih, pieces, interval, func(event string, v interface{}) error {
+		return writeEvent(w, flusher, event, v)
+	})
+	if err != nil {
+		log.Printf("progress write event to %s error: %v", r.RemoteAddr, err)
+	}
+}
+
+func newStatsEvent(t *torrent.Torrent, ih metainfo.Hash) statsEvent {
+	stats := t.Stats()
+	ev := statsEvent{
+		InfoHash:       ih.HexString(),
+		NumPieces:      t.NumPieces(),
+		BytesCompleted: t.BytesCompleted(),
+		Length:         t.Length(),
+		ActivePeers:    stats.ActivePeers,
+		TotalPeers:     stats.TotalPeers,
+	}
+	ev.PiecesCompleted, ev.PiecesPartial = utils.CountPieces(t.PieceStateRuns())
+	return ev
+}
+
+func writeEvent(w http.ResponseWriter, flusher http.Flusher, event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	if err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestProgressInterval(t *testing.T) {
+	tests := []struct {
+		seconds float64
+		want    time.Duration
+		err     bool
+	}{
+		{0, defaultProgressInterval, false},
+		{1.5, 1500 * time.Millisecond, false},
+		{1e-12, minProgressInterval, false}, // 转换后为0
+		{0.01, minProgressInterval, false},
+		{1e300, maxProgressInterval, false}, // 转换后溢出
+		{-1, 0, true},
+		{math.NaN(), 0, true},
+		{math.Inf(1), 0, true},
+	}
+	for _, tt := range tests {
+		got, err := progressInterval(tt.seconds)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("progressInterval(%v) = %v, %v", tt.seconds, got, err)
+		}
+	}
+}
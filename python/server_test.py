@@ -129,9 +129,15 @@ def test_start_downloading():
     else:
         print(ret)
 
-    # start_downloading
+    # start_downloading, 立即返回任务id
     url = f"http://localhost:{httpPort}/start_downloading/"
     ret = post(url, ret)
+    job = json.loads(ret)
+    print(job)
+
+    # wait_job
+    url = f"http://localhost:{httpPort}/wait_job/?id={job['job_id']}&timeout=60"
+    ret = get(url)
     print(json.loads(ret))
 
 
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 )
 
 // go读取二进制文件
@@ -33,3 +34,24 @@ func getFileSize(filePath string) (fileSize int64, err error) {
 	fileSize = fileInfo.Size()
 	return
 }
+
+// 先写临时文件再重命名, 避免正在做种的文件只写了一半
+func writeModelParam(filePath string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filePath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// 模型版本登记
+// 每个模型(model)有多个版本(version), 每个版本对应一个torrent, 以infohash区分内容
+// - send分发的是Model.ModelName的当前版本(mi), 模型文件变化后重新制作并登记为新版本
+// - 发布的版本一直做种, 直到被retire
+// - 基于文件的版本(tmpfs/disk)共用同一个文件, 同一个path发布新版本时旧版本的数据已经被覆盖, 会自动retire
+// - memory的版本一直占用内存, 每个模型只保留最新的Storage.MemoryVersions个, 更早的自动retire
+
+const defaultMemoryVersions = 3
+
+type modelVersion struct {
+	Model     string    `json:"model"`
+	Version   string    `json:"version"`
+	InfoHash  string    `json:"infohash"`
+	Name      string    `json:"name"`
+	Storage   string    `json:"storage"`
+	Path      string    `json:"path,omitempty"` // memory存储方式为空
+	Length    int64     `json:"length"`
+	Published time.Time `json:"published"`
+
+	mi *metainfo.MetaInfo
+}
+
+type modelRegistry struct {
+	mu     sync.Mutex
+	models map[string][]*modelVersion // 按发布顺序, 最后一个是latest
+}
+
+var registry = &modelRegistry{
+	models: make(map[string][]*modelVersion),
+}
+
+// 制作mi时模型文件的大小和修改时间, 用于发现文件被修改, 由mutex保护
+var modelFileSize int64
+var modelFileModTime time.Time
+
+type registryError struct {
+	code int
+	msg  string
+}
+
+func (e *registryError) Error() string {
+	return e.msg
+}
+
+// 默认的版本名: infohash的前8位
+func defaultVersionName(ih metainfo.Hash) string {
+	return ih.HexString()[:8]
+}
+
+// publish 登记一个已经开始做种的版本
+// 相同内容(infohash)重复发布时直接返回已有的版本
+func (reg *modelRegistry) publish(model, version, method, path string, mip *metainfo.MetaInfo) (*modelVersion, error) {
+	ih := mip.HashInfoBytes()
+	info, err := mip.UnmarshalInfo()
+	if err != nil {
+		return nil, err
+	}
+	if version == "" {
+		version = defaultVersionName(ih)
+	}
+	if version == "latest" {
+		return nil, &registryError{http.StatusBadRequest, `version "latest" is reserved`}
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for _, v := range reg.models[model] {
+		if v.InfoHash == ih.HexString() {
+			return v, nil
+		}
+		if v.Version == version {
+			return nil, &registryError{http.StatusConflict, fmt.Sprintf("model %s version %s already published with infohash %s", model, version, v.InfoHash)}
+		}
+	}
+
+	v := &modelVersion{
+		Model:     model,
+		Version:   version,
+		InfoHash:  ih.HexString(),
+		Name:      info.BestName(),
+		Storage:   method,
+		Path:      path,
+		Length:    info.TotalLength(),
+		Published: time.Now(),
+		mi:        mip,
+	}
+	var retired, kept []*modelVersion
+	for _, old := range reg.models[model] {
+		if path != "" && old.Path == path {
+			retired = append(retired, old)
+		} else {
+			kept = append(kept, old)
+		}
+	}
+	reg.models[model] = append(kept, v)
+	for _, old := range retired {
+		dropTorrent(old.mi.HashInfoBytes())
+		log.Printf("model %s version %s retired, %s overwritten", model, old.Version, path)
+	}
+	if method == "memory" {
+		for _, old := range reg.pruneMemoryLocked(model) {
+			dropTorrent(old.mi.HashInfoBytes())
+			log.Printf("model %s version %s retired, keep %d memory versions", model, old.Version, optionsStruct.Storage.MemoryVersions)
+		}
+	}
+	log.Printf("model %s version %s published, infohash %s", model, version, v.InfoHash)
+	return v, nil
+}
+
+// 只保留最新的Storage.MemoryVersions个memory版本, 返回需要retire的版本
+func (reg *modelRegistry) pruneMemoryLocked(model string) []*modelVersion {
+	keep := optionsStruct.Storage.MemoryVersions
+	if keep <= 0 {
+		return nil
+	}
+	versions := reg.models[model]
+	n := 0
+	for _, v := range versions {
+		if v.Storage == "memory" {
+			n++
+		}
+	}
+	var retired, kept []*modelVersion
+	for _, v := range versions {
+		if v.Storage == "memory" && n > keep {
+			retired = append(retired, v)
+			n--
+		} else {
+			kept = append(kept, v)
+		}
+	}
+	reg.models[model] = kept
+	return retired
+}
+
+// lookup 按版本名或infohash查找, 为空或latest时返回最新的版本
+func (reg *modelRegistry) lookup(model, version string) (*modelVersion, bool) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	versions := reg.models[model]
+	if len(versions) == 0 {
+		return nil, false
+	}
+	if version == "" || version == "latest" {
+		return versions[len(versions)-1], true
+	}
+	for _, v := range versions {
+		if v.Version == version || v.InfoHash == version {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (reg *modelRegistry) list(model string) map[string][]*modelVersion {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	ret := make(map[string][]*modelVersion)
+	for name, versions := range reg.models {
+		if model != "" && name != model {
+			continue
+		}
+		ret[name] = append([]*modelVersion(nil), versions...)
+	}
+	return ret
+}
+
+// retire 删除版本并卸载对应的torrent
+// version不为空时只retire该版本, 否则只保留最新的keep个版本
+func (reg *modelRegistry) retire(model, version string, keep int) []*modelVersion {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	versions := reg.models[model]
+	var retired, kept []*modelVersion
+	for i, v := range versions {
+		if version != "" && (v.Version == version || v.InfoHash == version) ||
+			version == "" && i < len(versions)-keep {
+			retired = append(retired, v)
+		} else {
+			kept = append(kept, v)
+		}
+	}
+	if len(kept) == 0 {
+		delete(reg.models, model)
+	} else {
+		reg.models[model] = kept
+	}
+	for _, v := range retired {
+		dropTorrent(v.mi.HashInfoBytes())
+		log.Printf("model %s version %s retired", model, v.Version)
+	}
+	return retired
+}
+
+// 版本数据在本地的路径, memory存储方式为空
+func versionDataPath(method string, mip *metainfo.MetaInfo) (string, error) {
+	if method == "memory" {
+		return "", nil
+	}
+	info, err := mip.UnmarshalInfo()
+	if err != nil {
+		return "", err
+	}
+	return torrentDataPath(method, mip.HashInfoBytes(), &info), nil
+}
+
+// 登记send制作的mi, 并记录模型文件的状态
+func publishCurrentModelLocked(method string) error {
+	path, err := versionDataPath(method, mi)
+	if err != nil {
+		return err
+	}
+	_, err = registry.publish(configStruct.Model.ModelName, "", method, path, mi)
+	if err != nil {
+		return err
+	}
+	recordModelFileLocked()
+	return nil
+}
+
+func recordModelFileLocked() {
+	fi, err := os.Stat(modelParamPath())
+	if err != nil {
+		modelFileSize, modelFileModTime = 0, time.Time{}
+		return
+	}
+	modelFileSize, modelFileModTime = fi.Size(), fi.ModTime()
+}
+
+// 模型文件在制作mi之后是否被修改过
+// 多级聚合时模型来自上一级server, 不检查本地文件
+func modelFileChangedLocked() bool {
+	if hasParent() {
+		return false
+	}
+	fi, err := os.Stat(modelParamPath())
+	if err != nil {
+		return false
+	}
+	return fi.Size() != modelFileSize || !fi.ModTime().Equal(modelFileModTime)
+}
+
+// 当前版本不再由send分发, 下一次send时重新制作
+// 基于文件的版本数据已经(或即将)被覆盖, 同时retire; memory的版本继续做种
+func invalidateCurrentModelLocked() {
+	if mi == nil {
+		return
+	}
+	ih := mi.HashInfoBytes()
+	v, ok := registry.lookup(configStruct.Model.ModelName, ih.HexString())
+	if !ok {
+		dropTorrent(ih)
+	} else if v.Path != "" {
+		registry.retire(v.Model, v.Version, 0)
+	}
+	mi = nil
+}
+
+// 发布模型版本
+// - 名称：publish_model
+// - 输入：json
+//   - model：模型名, 默认Model.ModelName
+//   - version：版本名, 默认infohash的前8位
+//   - storage：存储方法, 默认Storage.Method
+//   - mb：memory存储方式的数据
+//   - path：tmpfs/disk存储方式的文件路径
+//   - layout：为tensor时按tensor对齐safetensors文件
+// - 方法：POST
+// - 输出：登记的版本(json)
+//   - model为Model.ModelName时, 该版本成为send分发的当前版本
+
+type publishModelInput struct {
+	createTorrentInput
+	Model   string `json:"model"`
+	Version string `json:"version"`
+}
+
+// 制作torrent, 开始做种并登记版本
+func publishModel(input *publishModelInput) (*modelVersion, error) {
+	if input.Model == "" {
+		input.Model = configStruct.Model.ModelName
+	}
+	method, err := parseStorageMethod(input.Storage)
+	if err == nil {
+		err = input.check(method)
+	}
+	if err != nil {
+		return nil, apiErrorf(http.StatusBadRequest, errCodeInvalidInput, "%v", err)
+	}
+
+	// 制作torrent并开始做种
+	var mip *metainfo.MetaInfo
+	var existed bool
+	if input.Layout == layoutTensor {
+		mip, err = createTensorTorrent(method, &input.createTorrentInput)
+		if err == nil {
+			_, _, existed = findTorrent(mip.HashInfoBytes())
+			_, _, err = addTorrent(mip, method)
+		}
+	} else if method == "memory" {
+		if len(input.Mb.Data) == 0 {
+			return nil, apiErrorf(http.StatusBadRequest, errCodeInvalidInput, "publish model from memory: empty data")
+		}
+		mip, err = fromMemory(input.Mb.Data, input.buildOptions())
+		if err == nil {
+			_, _, existed = findTorrent(mip.HashInfoBytes())
+			err = seed(mip, &storage.MemoryBuf{
+				Data:   input.Mb.Data,
+				Length: int64(len(input.Mb.Data)),
+			})
+		}
+	} else {
+		if input.Path == "" {
+			return nil, apiErrorf(http.StatusBadRequest, errCodeInvalidInput, "publish model from %s: empty path", method)
+		}
+		if method == "disk" {
+			mip, err = fromDisk(input.Path, input.buildOptions())
+		} else {
+			mip, err = fromTMPFS(input.Path, input.buildOptions())
+		}
+		if err == nil {
+			_, _, existed = findTorrent(mip.HashInfoBytes())
+			_, _, err = addTorrent(mip, method)
+		}
+	}
+	if err != nil {
+		return nil, apiErrorf(http.StatusInternalServerError, errCodeInternal, "publish model %s from %s: %v", input.Model, method, err)
+	}
+
+	path, err := versionDataPath(method, mip)
+	if err != nil {
+		return nil, apiErrorf(http.StatusInternalServerError, errCodeInternal, "publish model %s: %v", input.Model, err).on(mip.HashInfoBytes())
+	}
+	mutex.Lock()
+	v, err := registry.publish(input.Model, input.Version, method, path, mip)
+	if err == nil && input.Model == configStruct.Model.ModelName {
+		mi = v.mi
+		recordModelFileLocked()
+	}
+	mutex.Unlock()
+	if err != nil {
+		if !existed {
+			dropTorrent(mip.HashInfoBytes())
+		}
+		return nil, toAPIError(err).on(mip.HashInfoBytes())
+	}
+	return v, nil
+}
+
+func publish_model(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
+	if r.Method != "POST" {
+		log.Printf("Invalid request method %s", r.Method)
+		http.Error(w, fmt.Sprintf("Invalid request method %s", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	dataBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("publish_model read data error: %v", err)
+		http.Error(w, "Read data failed", http.StatusInternalServerError)
+		return
+	}
+	var input publishModelInput
+	err = json.Unmarshal(dataBytes, &input)
+	if err != nil {
+		log.Printf("publish_model json unmarshal error: %v", err)
+		http.Error(w, "Data malformat", http.StatusBadRequest)
+		return
+	}
+	v, err := publishModel(&input)
+	if err != nil {
+		log.Printf("publish_model error: %v", err)
+		writeRegistryError(w, err)
+		return
+	}
+	writeRegistryJson(w, v)
+}
+
+// 列出模型版本
+// - 名称：list_models
+// - 输入：model(query, 可选)
+// - 方法：GET
+// - 输出：{model: [version, ...]}(json), 按发布顺序
+
+func list_models(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
+	writeRegistryJson(w, registry.list(r.URL.Query().Get("model")))
+}
+
+// 获取模型版本的torrent
+// - 名称：get_model
+// - 输入：model(query, 默认Model.ModelName), version(query, 版本名/infohash/latest, 默认latest)
+// - 方法：GET
+// - 输出：torrent
+
+func get_model(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
+	model := r.URL.Query().Get("model")
+	if model == "" {
+		model = configStruct.Model.ModelName
+	}
+	v, ok := registry.lookup(model, r.URL.Query().Get("version"))
+	if !ok {
+		http.Error(w, "Model version not found", http.StatusNotFound)
+		return
+	}
+	err := v.mi.Write(w)
+	if err != nil {
+		log.Printf("send model %s version %s to %s error: %v", model, v.Version, r.RemoteAddr, err)
+	}
+}
+
+// 删除模型版本, 停止做种
+// - 名称：retire_model
+// - 输入：model(query, 默认Model.ModelName), version(query)或keep(query, 保留最新的版本数)
+// - 方法：POST
+// - 输出：被删除的版本(json)
+
+func retire_model(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
+	if r.Method != "POST" {
+		log.Printf("Invalid request method %s", r.Method)
+		http.Error(w, fmt.Sprintf("Invalid request method %s", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	model := query.Get("model")
+	if model == "" {
+		model = configStruct.Model.ModelName
+	}
+	version := query.Get("version")
+	keep := 0
+	if s := query.Get("keep"); s != "" {
+		var err error
+		keep, err = strconv.Atoi(s)
+		if err != nil || keep < 0 {
+			http.Error(w, fmt.Sprintf("Invalid keep %q", s), http.StatusBadRequest)
+			return
+		}
+	} else if version == "" {
+		http.Error(w, "version or keep is required", http.StatusBadRequest)
+		return
+	}
+
+	retired := retireModel(model, version, keep)
+	if version != "" && len(retired) == 0 {
+		http.Error(w, "Model version not found", http.StatusNotFound)
+		return
+	}
+	writeRegistryJson(w, retired)
+}
+
+// 删除模型版本, 返回被删除的版本
+func retireModel(model, version string, keep int) []*modelVersion {
+	mutex.Lock()
+	defer mutex.Unlock()
+	retired := registry.retire(model, version, keep)
+	for _, v := range retired {
+		// send分发的版本被删除, 下一次send时重新制作
+		if mi != nil && v.InfoHash == mi.HashInfoBytes().HexString() {
+			mi = nil
+		}
+	}
+	return retired
+}
+
+func writeRegistryError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), errorStatus(err))
+}
+
+func writeRegistryJson(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("json marshal error: %v", err)
+		http.Error(w, "Json marshal failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
@@ -0,0 +1,670 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// 联邦学习的训练轮次
+// 每一轮: server通过handleSend分发模型, client完成接收后调用handleCompleteSend,
+// 训练结束后通过handleRecv回传更新; 所有参与者回传后本轮结束
+// 超时后未回传的client记为straggler, 达到MinClients时本轮仍然算完成
+// client的标识: 有参与者列表时为请求的ip; 开启Auth时为认证得到的身份(token对应的身份或证书的CommonName),
+// 每个client需要自己的token或证书; 都没有时, 带name的/send/由server在响应中分配id(X-Client-Id),
+// client之后的请求带上这个id, 同一个ip后面的多个client也可以区分; 没有id也没有name的请求按ip统计
+
+const (
+	roundOpen      = "open"
+	roundCompleted = "completed"
+	roundFailed    = "failed" // 超时且回传的client数量不足MinClients
+	roundClosed    = "closed" // 被下一轮提前关闭
+)
+
+const maxRoundHistory = 100 // round_status可以查询的历史轮次
+
+// 单个client在一轮中的状态
+type clientRoundState struct {
+	Client      string    `json:"client"`
+	Requested   bool      `json:"requested"` // 已经从/send/获取torrent
+	RequestedAt time.Time `json:"requested_at"`
+	Sent        bool      `json:"sent"` // 已经完成接收模型
+	SentAt      time.Time `json:"sent_at"`
+	Recv        bool      `json:"recv"` // 已经回传更新
+	RecvAt      time.Time `json:"recv_at"`
+	RecvBytes   int       `json:"recv_bytes"`
+	Uploading   string    `json:"uploading,omitempty"` // 通过BitTorrent回传的torrent, 下载完成前不为空
+	Straggler   bool      `json:"straggler"`
+}
+
+type round struct {
+	Number       int                          `json:"number"`
+	ModelVersion string                       `json:"model_version"`
+	Participants []string                     `json:"participants"` // 为空时只按数量统计
+	Expected     int                          `json:"expected"`     // 需要回传的client数量
+	MinClients   int                          `json:"min_clients"`
+	State        string                       `json:"state"`
+	Opened       time.Time                    `json:"opened"`
+	FirstSend    time.Time                    `json:"first_send"` // 收到第一个send的时间
+	Deadline     time.Time                    `json:"deadline"`   // 为空表示不超时
+	Finished     time.Time                    `json:"finished"`
+	Clients      map[string]*clientRoundState `json:"clients"`
+	Stragglers   []string                     `json:"stragglers,omitempty"`
+	// 聚合的状态, 只有开启Aggregate.Enabled时才有
+	Aggregation  string `json:"aggregation,omitempty"`
+	TotalSamples int64  `json:"total_samples,omitempty"`
+
+	timer   *time.Timer
+	updates map[string]*modelUpdate // 每个client回传的更新
+}
+
+type roundCoordinator struct {
+	mu      sync.Mutex
+	current *round
+	history []*round
+}
+
+var rounds = &roundCoordinator{}
+
+type openRoundInput struct {
+	ModelVersion string   `json:"model_version"`
+	Participants []string `json:"participants"` // 为空时使用Client.IPList
+	Timeout      float64  `json:"timeout"`      // 秒, 为0时使用配置的Round.Timeout
+	MinClients   int      `json:"min_clients"`  // 为0时使用配置的Round.MinClients
+	// 重新读取模型并在下一次send时重新制作torrent
+	Reload bool `json:"reload"`
+}
+
+// open 关闭当前轮次并开启下一轮
+// 上一轮还在聚合时返回错误, 否则新一轮的send会分发聚合前的模型
+func (c *roundCoordinator) open(input openRoundInput) (*round, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.aggregatingLocked()
+	if err != nil {
+		return nil, err
+	}
+	number := 1
+	if c.current != nil {
+		number = c.current.Number + 1
+		if c.current.State == roundOpen {
+			c.finishLocked(c.current, roundClosed)
+		}
+	}
+
+	participants := input.Participants
+	if len(participants) == 0 {
+		participants = configStruct.Client.IPList
+	}
+	expected := len(participants)
+	if expected == 0 {
+		expected = configStruct.Client.TotalPeers
+	}
+	timeout := time.Duration(input.Timeout * float64(time.Second))
+	if timeout == 0 {
+		timeout = time.Duration(optionsStruct.Round.Timeout * float64(time.Second))
+	}
+	minClients := input.MinClients
+	if minClients == 0 {
+		minClients = optionsStruct.Round.MinClients
+	}
+	if minClients == 0 || minClients > expected {
+		minClients = expected
+	}
+	modelVersion := input.ModelVersion
+	if modelVersion == "" {
+		modelVersion = fmt.Sprintf("round-%d", number)
+	}
+
+	rd := &round{
+		Number:       number,
+		ModelVersion: modelVersion,
+		Participants: participants,
+		Expected:     expected,
+		MinClients:   minClients,
+		State:        roundOpen,
+		Opened:       time.Now(),
+		Clients:      make(map[string]*clientRoundState),
+		updates:      make(map[string]*modelUpdate),
+	}
+	for _, p := range participants {
+		rd.Clients[p] = &clientRoundState{Client: p}
+	}
+	if timeout > 0 {
+		rd.Deadline = rd.Opened.Add(timeout)
+		rd.timer = time.AfterFunc(timeout, func() {
+			c.timeout(rd)
+		})
+	}
+	c.current = rd
+	c.history = append(c.history, rd)
+	if len(c.history) > maxRoundHistory {
+		c.history = append([]*round(nil), c.history[len(c.history)-maxRoundHistory:]...)
+	}
+	log.Printf("open round %d, model version %s, expected %d clients, min %d clients, timeout %v",
+		rd.Number, rd.ModelVersion, rd.Expected, rd.MinClients, timeout)
+	return rd, nil
+}
+
+func (c *roundCoordinator) aggregatingLocked() error {
+	if c.current != nil && c.current.Aggregation == aggregationRunning {
+		return &roundError{http.StatusConflict, fmt.Sprintf("round %d is still aggregating", c.current.Number)}
+	}
+	return nil
+}
+
+func (c *roundCoordinator) aggregating() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.aggregatingLocked()
+}
+
+// 超时: 未回传的client记为straggler
+func (c *roundCoordinator) timeout(rd *round) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if rd.State != roundOpen {
+		return
+	}
+	recv := rd.recvCount()
+	if recv >= rd.MinClients {
+		c.finishLocked(rd, roundCompleted)
+	} else {
+		c.finishLocked(rd, roundFailed)
+	}
+	log.Printf("round %d timeout, %d/%d clients uploaded, stragglers: %v", rd.Number, recv, rd.Expected, rd.Stragglers)
+}
+
+func (c *roundCoordinator) finishLocked(rd *round, state string) {
+	if rd.timer != nil {
+		rd.timer.Stop()
+	}
+	rd.State = state
+	rd.Finished = time.Now()
+	rd.Stragglers = nil
+	for _, cs := range rd.Clients {
+		if !cs.Recv {
+			cs.Straggler = true
+			rd.Stragglers = append(rd.Stragglers, cs.Client)
+		}
+	}
+	sort.Strings(rd.Stragglers)
+
+	// 本轮完成后聚合收到的更新, 结果作为下一次send分发的模型
+	if state == roundCompleted && len(rd.updates) > 0 {
+		updates := make([]*modelUpdate, 0, len(rd.updates))
+		clients := make([]string, 0, len(rd.updates))
+		for client := range rd.updates {
+			clients = append(clients, client)
+		}
+		sort.Strings(clients)
+		for _, client := range clients {
+			updates = append(updates, rd.updates[client])
+		}
+		rd.Aggregation = aggregationRunning
+		go c.aggregate(rd, updates)
+	}
+	rd.updates = nil
+
+	start := rd.FirstSend
+	if start.IsZero() {
+		start = rd.Opened
+	}
+	log.Printf("PS, %s, round %d %s, total time: %v", configStruct.Model.ModelName, rd.Number, state, rd.Finished.Sub(start))
+}
+
+const (
+	aggregationRunning = "running"
+	aggregationDone    = "done"
+	aggregationFailed  = "failed"
+)
+
+func (c *roundCoordinator) aggregate(rd *round, updates []*modelUpdate) {
+	totalSamples, err := aggregateRound(rd.Number, updates)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		log.Printf("round %d aggregate error: %v", rd.Number, err)
+		rd.Aggregation = fmt.Sprintf("%s: %v", aggregationFailed, err)
+		return
+	}
+	rd.Aggregation = aggregationDone
+	rd.TotalSamples = totalSamples
+}
+
+func (rd *round) recvCount() (n int) {
+	for _, cs := range rd.Clients {
+		if cs.Recv {
+			n++
+		}
+	}
+	return
+}
+
+func (rd *round) sentCount() (n int) {
+	for _, cs := range rd.Clients {
+		if cs.Sent {
+			n++
+		}
+	}
+	return
+}
+
+// 请求中的client
+type roundClient struct {
+	ip       string // 请求的来源ip
+	id       string // 请求中的id或分配的id, 开启Auth时为认证得到的身份, 在响应中返回(X-Client-Id)
+	name     string // 分配id时使用的名字, 只用于显示
+	identity string // 开启Auth时认证得到的身份
+	key      string // 查找后为client在本轮中的标识: id, 或者没有id时为ip
+}
+
+// 查找client的状态, 不在参与者列表中时返回错误
+func (rd *round) clientLocked(rc *roundClient) (*clientRoundState, error) {
+	var key string
+	switch {
+	case len(rd.Participants) > 0:
+		// 与Client.IPList中的ip对应, 忽略请求中的id
+		key = rc.ip
+		rc.id = ""
+	case rc.identity != "":
+		// 不能使用其它身份的id
+		if rc.id != "" && rc.id != rc.identity {
+			return nil, fmt.Errorf("client id %q does not match identity %q", rc.id, rc.identity)
+		}
+		key = rc.identity
+		rc.id = key
+	case rc.id != "":
+		if !validClientID(rc.id) {
+			return nil, fmt.Errorf("invalid client id %q", rc.id)
+		}
+		key = rc.id
+	default:
+		// 没有id的请求按ip统计, 不为每个请求记录新的client
+		key = rc.ip
+	}
+	rc.key = key
+	cs, ok := rd.Clients[key]
+	if ok {
+		return cs, nil
+	}
+	if len(rd.Participants) > 0 {
+		return nil, fmt.Errorf("client %s is not a participant of round %d", key, rd.Number)
+	}
+	cs = &clientRoundState{Client: key}
+	rd.Clients[key] = cs
+	return cs, nil
+}
+
+// 分配的client id: <name>.<随机数>.<签名>
+// 签名使用server启动时生成的key, client不能伪造其它client的id, server重启后需要重新获取
+const clientIDHeader = "X-Client-Id"
+
+// /send/的响应中的轮次, client回传时可以带上, 避免记录到其它轮次
+const roundHeader = "X-Round"
+
+// 在响应中返回client id, 按ip统计的client没有id
+func setClientIDHeader(w http.ResponseWriter, client *roundClient) {
+	if client.id != "" {
+		w.Header().Set(clientIDHeader, client.id)
+	}
+}
+
+var clientIDKey = func() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}()
+
+func signClientID(payload string) string {
+	mac := hmac.New(sha256.New, clientIDKey)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+func newClientID(name string) string {
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	nonce := make([]byte, 4)
+	rand.Read(nonce)
+	payload := name + "." + hex.EncodeToString(nonce)
+	return payload + "." + signClientID(payload)
+}
+
+func validClientID(id string) bool {
+	i := strings.LastIndexByte(id, '.')
+	if i < 0 {
+		return false
+	}
+	return hmac.Equal([]byte(id[i+1:]), []byte(signClientID(id[:i])))
+}
+
+// roundError 表示请求与当前轮次不符
+type roundError struct {
+	code int
+	msg  string
+}
+
+func (e *roundError) Error() string { return e.msg }
+
+// 检查请求的轮次, 返回当前轮次
+// number为0时不检查
+func (c *roundCoordinator) currentLocked(number int) (*round, error) {
+	rd := c.current
+	if rd == nil {
+		return nil, &roundError{http.StatusConflict, "no round is open"}
+	}
+	if number != 0 && number != rd.Number {
+		return nil, &roundError{http.StatusConflict, fmt.Sprintf("round %d is not the current round %d", number, rd.Number)}
+	}
+	if rd.State != roundOpen {
+		return nil, &roundError{http.StatusConflict, fmt.Sprintf("round %d is %s", rd.Number, rd.State)}
+	}
+	return rd, nil
+}
+
+// client通过/send/获取torrent, 返回当前轮次
+// after不为0时, 当前轮次不大于after时返回错误(下一轮还没有开启)
+func (c *roundCoordinator) requested(client *roundClient, number, after int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rd, err := c.currentLocked(number)
+	if err != nil {
+		return 0, err
+	}
+	if after != 0 && rd.Number <= after {
+		return 0, &roundError{http.StatusConflict, fmt.Sprintf("round after %d is not open yet", after)}
+	}
+	// 带name的请求分配id, client之后的请求带上这个id
+	if client.id == "" && client.identity == "" && client.name != "" && len(rd.Participants) == 0 {
+		client.id = newClientID(client.name)
+	}
+	cs, err := rd.clientLocked(client)
+	if err != nil {
+		return 0, &roundError{http.StatusForbidden, err.Error()}
+	}
+	now := time.Now()
+	// 从收到第一个send开始计时
+	if rd.FirstSend.IsZero() {
+		rd.FirstSend = now
+		log.Printf("round %d start timer", rd.Number)
+	}
+	cs.Requested = true
+	cs.RequestedAt = now
+	return rd.Number, nil
+}
+
+// client完成接收模型
+func (c *roundCoordinator) sent(client *roundClient, number int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rd, err := c.currentLocked(number)
+	if err != nil {
+		return err
+	}
+	cs, err := rd.clientLocked(client)
+	if err != nil {
+		return &roundError{http.StatusForbidden, err.Error()}
+	}
+	if !cs.Sent {
+		cs.Sent = true
+		cs.SentAt = time.Now()
+	}
+	log.Printf("round %d: %s add sendTimes to %d", rd.Number, cs.Client, rd.sentCount())
+	return nil
+}
+
+// client通过BitTorrent回传更新, server开始下载
+// 返回当前轮次, 下载完成后记录到这一轮, 而不是下载完成时的当前轮次
+func (c *roundCoordinator) uploading(client *roundClient, number int, ih metainfo.Hash) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rd, err := c.currentLocked(number)
+	if err != nil {
+		return 0, err
+	}
+	cs, err := rd.clientLocked(client)
+	if err != nil {
+		return 0, &roundError{http.StatusForbidden, err.Error()}
+	}
+	if cs.Recv {
+		return 0, &roundError{http.StatusConflict, fmt.Sprintf("client %s already uploaded in round %d", cs.Client, rd.Number)}
+	}
+	cs.Uploading = ih.HexString()
+	log.Printf("round %d: %s uploading %s", rd.Number, cs.Client, cs.Uploading)
+	return rd.Number, nil
+}
+
+// client回传更新, 所有参与者都回传后本轮结束
+// u为nil表示没有开启聚合
+func (c *roundCoordinator) recv(client *roundClient, number int, n int, u *modelUpdate) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rd, err := c.currentLocked(number)
+	if err != nil {
+		return err
+	}
+	cs, err := rd.clientLocked(client)
+	if err != nil {
+		return &roundError{http.StatusForbidden, err.Error()}
+	}
+	if cs.Recv {
+		return &roundError{http.StatusConflict, fmt.Sprintf("client %s already uploaded in round %d", cs.Client, rd.Number)}
+	}
+	cs.Recv = true
+	cs.RecvAt = time.Now()
+	cs.Uploading = ""
+	cs.RecvBytes = n
+	if u != nil {
+		rd.updates[cs.Client] = u
+	}
+	recv := rd.recvCount()
+	log.Printf("round %d: recv %d bytes from %s, %d/%d", rd.Number, n, cs.Client, recv, rd.Expected)
+	if recv >= rd.Expected {
+		c.finishLocked(rd, roundCompleted)
+	}
+	return nil
+}
+
+// 当前轮次完成接收的client数量
+func (c *roundCoordinator) sendTimes() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current == nil {
+		return 0
+	}
+	return c.current.sentCount()
+}
+
+// 轮次的状态, 复制一份避免与修改并发
+func (c *roundCoordinator) status(number int) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rd := c.current
+	if number != 0 {
+		rd = nil
+		for _, h := range c.history {
+			if h.Number == number {
+				rd = h
+			}
+		}
+	}
+	if rd == nil {
+		return nil, false
+	}
+	data, err := json.Marshal(rd)
+	if err != nil {
+		log.Printf("round json marshal error: %v", err)
+		return nil, false
+	}
+	return data, true
+}
+
+// 请求中的client和round参数
+// client的id在X-Client-Id或client参数中, name参数只在分配id时使用
+// 开启Auth时client的标识为认证得到的身份, 请求中的id必须与它相同
+func roundRequest(r *http.Request) (client *roundClient, number int, err error) {
+	client = &roundClient{
+		ip:       remoteIP(r),
+		id:       r.Header.Get(clientIDHeader),
+		name:     r.URL.Query().Get("name"),
+		identity: requestIdentity(r),
+	}
+	if client.id == "" {
+		client.id = r.URL.Query().Get("client")
+	}
+	number, err = queryRoundNumber(r, "round")
+	if err != nil {
+		return nil, 0, err
+	}
+	return client, number, nil
+}
+
+// query中的轮次参数, 为空时返回0
+func queryRoundNumber(r *http.Request, name string) (int, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return 0, nil
+	}
+	number, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, &roundError{http.StatusBadRequest, fmt.Sprintf("invalid %s %q", name, s)}
+	}
+	return number, nil
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func writeRoundError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), errorStatus(err))
+}
+
+// 开启下一轮
+
+// - 名称：open_round
+// - 输入：openRoundInput(json, 可以为空)
+// - 方法：POST
+// - 输出：新一轮的状态, 上一轮还在聚合时返回409
+
+func open_round(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
+	if r.Method != "POST" {
+		log.Printf("Invalid request method %s", r.Method)
+		http.Error(w, fmt.Sprintf("Invalid request method %s", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	dataBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("open_round read data error: %v", err)
+		http.Error(w, "Read data failed", http.StatusInternalServerError)
+		return
+	}
+	var input openRoundInput
+	if len(dataBytes) > 0 {
+		err = json.Unmarshal(dataBytes, &input)
+		if err != nil {
+			log.Printf("open_round json unmarshal error: %v", err)
+			http.Error(w, "Data malformat", http.StatusBadRequest)
+			return
+		}
+	}
+
+	data, err := openRound(input)
+	if err != nil {
+		log.Printf("open_round error: %v", err)
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.Write(data)
+}
+
+// 开启下一轮, 返回新一轮的状态(json)
+func openRound(input openRoundInput) ([]byte, error) {
+	// 聚合的结果会覆盖重新读取的模型
+	err := rounds.aggregating()
+	if err != nil {
+		return nil, err
+	}
+	if input.Reload {
+		err = reloadModel()
+		if err != nil {
+			return nil, apiErrorf(http.StatusInternalServerError, errCodeInternal, "reload model: %v", err)
+		}
+	}
+	rd, err := rounds.open(input)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := rounds.status(rd.Number)
+	return data, nil
+}
+
+// - 名称：round_status
+// - 输入：round(query, 为空时返回当前轮次)
+// - 方法：GET
+// - 输出：轮次的状态, 包括每个client的send/recv状态
+
+func round_status(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
+	number := 0
+	if s := r.URL.Query().Get("round"); s != "" {
+		var err error
+		number, err = strconv.Atoi(s)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid round %q", s), http.StatusBadRequest)
+			return
+		}
+	}
+	data, ok := rounds.status(number)
+	if !ok {
+		http.Error(w, "Round not found", http.StatusNotFound)
+		return
+	}
+	w.Write(data)
+}
+
+// 重新读取模型, 下一次send时重新制作torrent
+func reloadModel() error {
+	if hasParent() {
+		// 模型从上一级server获取
+		mutex.Lock()
+		defer mutex.Unlock()
+		invalidateCurrentModelLocked()
+		return nil
+	}
+	modleParamPath := modelParamPath()
+	newData, err := readModelParam(modleParamPath)
+	if err != nil {
+		return err
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	// 文件内容已经变化, 下一次send时重新制作torrent
+	invalidateCurrentModelLocked()
+	data = newData
+	log.Printf("reload %d bytes from model %s", len(data), modleParamPath)
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// 部分下载
+// 分片的checkpoint(多文件torrent)和流水线并行的worker只需要其中一部分数据
+// start_downloading的torrent中可以额外携带(与storage相同, 解码MetaInfo时会被忽略):
+// - files：需要下载的文件, torrent中的路径(不包括torrent的名称), 也可以带上torrent的名称
+// - ranges：需要下载的字节范围[begin, end), 相对于torrent中所有文件拼接后的数据
+// 只下载并等待覆盖这些文件/范围的piece, 都为空时下载整个torrent
+
+type downloadSelection struct {
+	Files  []string  `bencode:"files,omitempty"`
+	Ranges [][]int64 `bencode:"ranges,omitempty"`
+}
+
+// 下载结果中请求的文件
+type selectedFile struct {
+	Path   string `json:"path"`            // torrent中的路径
+	Local  string `json:"local,omitempty"` // 本地路径, memory存储方式为空
+	Offset int64  `json:"offset"`          // 在torrent数据(memory存储方式的mb)中的位置
+	Length int64  `json:"length"`
+}
+
+func bdecodeSelection(metaInfoBytes []byte) (*downloadSelection, error) {
+	var extra downloadSelection
+	err := bencode.NewDecoder(bytes.NewBuffer(metaInfoBytes)).Decode(&extra)
+	if err != nil {
+		return nil, fmt.Errorf("bdecode files/ranges: %w", err)
+	}
+	if len(extra.Files) == 0 && len(extra.Ranges) == 0 {
+		return nil, nil
+	}
+	return &extra, nil
+}
+
+// 计算覆盖请求的文件/范围的piece, 返回合并后的piece范围[begin, end)
+// 同时在output中记录每个请求的文件在本地的位置
+func selectPieces(sel *downloadSelection, method string, ih metainfo.Hash, info *metainfo.Info, output *startDownloadingOutput) error {
+	var byteRanges [][2]int64
+	output.Files = nil
+	for _, path := range sel.Files {
+		f, ok := findInfoFile(method, ih, info, path)
+		if !ok {
+			return fmt.Errorf("file %q not in torrent", path)
+		}
+		output.Files = append(output.Files, f)
+		byteRanges = append(byteRanges, [2]int64{f.Offset, f.Offset + f.Length})
+	}
+	for _, r := range sel.Ranges {
+		if len(r) != 2 || r[0] < 0 || r[0] > r[1] || r[1] > info.TotalLength() {
+			return fmt.Errorf("invalid range %v, torrent length %d", r, info.TotalLength())
+		}
+		byteRanges = append(byteRanges, [2]int64{r[0], r[1]})
+	}
+
+	// 标记覆盖的piece, 再合并成连续的范围
+	covered := make([]bool, info.NumPieces())
+	for _, r := range byteRanges {
+		if r[0] == r[1] {
+			continue
+		}
+		for i := r[0] / info.PieceLength; i < (r[1]+info.PieceLength-1)/info.PieceLength; i++ {
+			covered[i] = true
+		}
+	}
+	output.Pieces = [][2]int{}
+	for i := 0; i < len(covered); i++ {
+		if !covered[i] {
+			continue
+		}
+		if n := len(output.Pieces); n > 0 && output.Pieces[n-1][1] == i {
+			output.Pieces[n-1][1] = i + 1
+		} else {
+			output.Pieces = append(output.Pieces, [2]int{i, i + 1})
+		}
+	}
+	return nil
+}
+
+// 按路径查找torrent中的文件
+func findInfoFile(method string, ih metainfo.Hash, info *metainfo.Info, path string) (selectedFile, bool) {
+	path = strings.Trim(filepath.ToSlash(path), "/")
+	for _, f := range infoFiles(method, ih, info) {
+		if path == f.Path || path == info.Name+"/"+f.Path {
+			return f, true
+		}
+	}
+	return selectedFile{}, false
+}
+
+// torrent中所有文件在本地的位置
+func infoFiles(method string, ih metainfo.Hash, info *metainfo.Info) []selectedFile {
+	var files []selectedFile
+	var offset int64
+	for _, fi := range info.UpvertedFiles() {
+		f := selectedFile{
+			Path:   info.Name,
+			Offset: offset,
+			Length: fi.Length,
+		}
+		if info.IsDir() {
+			f.Path = strings.Join(fi.Path, "/")
+		}
+		f.Local = fileDataPath(method, ih, info, f.Path)
+		files = append(files, f)
+		offset += fi.Length
+	}
+	return files
+}
+
+// 文件在本地的路径, memory存储方式为空
+func fileDataPath(method string, ih metainfo.Hash, info *metainfo.Info, path string) string {
+	if method == "memory" {
+		return ""
+	}
+	if !info.IsDir() {
+		return torrentDataPath(method, ih, info)
+	}
+	return filepath.Join(torrentDataPath(method, ih, info), filepath.FromSlash(path))
+}
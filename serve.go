@@ -7,8 +7,12 @@ import (
 	// "net/http"
 	"encoding/hex"
 	"encoding/json"
+	"io"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/bradfitz/iter"
 
@@ -20,7 +24,8 @@ import (
 	"github.com/anacrolix/torrent/storage"
 )
 
-var Trackers = [][]string{
+// 没有配置Torrent.Trackers时使用的tracker
+var defaultTrackers = [][]string{
 	// {"udp://tracker.opentrackr.org:1337/announce"},
 	// {"udp://tracker.openbittorrent.com:6969/announce"},
 	// {"udp://tracker.moeking.me:6969/announce"},
@@ -29,86 +34,287 @@ var Trackers = [][]string{
 	// {`wss://tracker.openwebtorrent.com`},
 	// {"udp://tracker.opentrackr.org:1337/announce"},
 	// {"udp://tracker.openbittorrent.com:6969/announce"},
-	{"udp://47.109.111.117:6969/annouce"}, // chihaya
+	{"udp://47.109.111.117:6969/announce"}, // chihaya
 }
 
-func fromMemory(byteData []byte) (*metainfo.MetaInfo, error) {
-	info := metainfo.Info{}
-	mi := metainfo.MetaInfo{}
-	err := info.BuildFromMemory(byteData, "from memory")
+// 制作torrent的选项, 零值使用默认设置
+type buildOptions struct {
+	// 多文件torrent中的文件及其顺序, 相对于filePath(目录)
+	// 为空时filePath为文件则制作单文件torrent, 为目录则包含其中所有文件(按路径排序)
+	Files []string
+	// piece length, 为0时使用config中的设置
+	PieceLength pieceLengthOption
+	// tracker, 为nil时使用config中的设置, 为空时不使用tracker
+	Trackers [][]string
+}
+
+func fromMemory(byteData []byte, opts buildOptions) (*metainfo.MetaInfo, error) {
+	pieceLength, how := choosePieceLength(opts.PieceLength, int64(len(byteData)))
+	info := metainfo.Info{PieceLength: pieceLength}
+	err := buildInfoFromMemory(&info, byteData, "from memory")
 	if err != nil {
 		return nil, err
 	}
-	mi.SetDefaults()
-	mi.InfoBytes = bencode.MustMarshal(info)
-	// tracker也应该是可以配置的,不应该固定
-	mi.Announce = Trackers[0][0]
-	mi.AnnounceList = Trackers
+	mi := newMetaInfo(&info)
+	mi.Comment = pieceLengthComment(pieceLength, how)
+	setTrackers(mi, opts.Trackers)
+	return mi, nil
+}
 
-	return &mi, nil
+// tmpfs基于文件路径制作torrent
+// 数据必须位于ModelPath中, 否则torrentClient做种时找不到数据, 也避免对任意文件计算hash并做种
+func fromTMPFS(filePath string, opts buildOptions) (*metainfo.MetaInfo, error) {
+	err := checkInStorageDir("tmpfs", filePath)
+	if err != nil {
+		return nil, err
+	}
+	return fromPath(filePath, opts)
 }
 
-func fromTMPFS(filePath string) (*metainfo.MetaInfo, error) {
+// 基于文件(或多文件torrent的目录)制作torrent, 调用者负责检查路径
+func fromPath(filePath string, opts buildOptions) (*metainfo.MetaInfo, error) {
 	// 1) get the Info which describes the filePath
 	// 2) get the MetaInfo with all fields set
 
+	// 文件没有变化时使用缓存的MetaInfo, 不需要重新计算hash
+	info, err := listInfoFiles(filePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	state, err := statInfoFiles(filePath, info)
+	if err != nil {
+		return nil, err
+	}
+	if mi, ok := metainfoCache.get(filePath, opts, state); ok {
+		setTrackers(mi, opts.Trackers)
+		return mi, nil
+	}
+
 	// Info
-	info := metainfo.Info{}
-	err := info.BuildFromFilePath(filePath)
+	how, err := hashInfoFromPath(filePath, info, opts)
 	if err != nil {
 		return nil, err
 	}
 
 	// MetaInfo
+	mi := newMetaInfo(info)
+	mi.Comment = pieceLengthComment(info.PieceLength, how)
+	metainfoCache.put(filePath, opts, state, mi)
+	setTrackers(mi, opts.Trackers)
+	return mi, nil
+}
+
+// 与Info.BuildFromFilePath相同, 但是可以指定多文件torrent中的文件顺序
+// 返回的Info只包括文件, 还没有计算piece hash
+func listInfoFiles(filePath string, opts buildOptions) (*metainfo.Info, error) {
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	info := &metainfo.Info{
+		Name: filepath.Base(filepath.Clean(filePath)),
+	}
+	if !fi.IsDir() {
+		if len(opts.Files) != 0 {
+			return nil, fmt.Errorf("%s is not a directory", filePath)
+		}
+		info.Length = fi.Size()
+	} else if len(opts.Files) == 0 {
+		err = filepath.Walk(filePath, func(path string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(filePath, path)
+			if err != nil {
+				return err
+			}
+			info.Files = append(info.Files, metainfo.FileInfo{
+				Path:   strings.Split(filepath.ToSlash(rel), "/"),
+				Length: fi.Size(),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(info.Files) == 0 {
+			return nil, fmt.Errorf("no file in %s", filePath)
+		}
+		// 与BuildFromFilePath相同, 按完整路径排序
+		sort.Slice(info.Files, func(i, j int) bool {
+			return strings.Join(info.Files[i].Path, "/") < strings.Join(info.Files[j].Path, "/")
+		})
+	} else {
+		seen := make(map[string]bool)
+		for _, f := range opts.Files {
+			rel := f
+			if filepath.IsAbs(f) {
+				rel, err = filepath.Rel(filePath, f)
+				if err != nil {
+					return nil, err
+				}
+			}
+			rel = filepath.ToSlash(filepath.Clean(rel))
+			if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+				return nil, fmt.Errorf("%s is not in %s", f, filePath)
+			}
+			if seen[rel] {
+				return nil, fmt.Errorf("duplicate file %s", f)
+			}
+			seen[rel] = true
+			fi, err := os.Stat(filepath.Join(filePath, filepath.FromSlash(rel)))
+			if err != nil {
+				return nil, err
+			}
+			if !fi.Mode().IsRegular() {
+				return nil, fmt.Errorf("%s is not a regular file", f)
+			}
+			info.Files = append(info.Files, metainfo.FileInfo{
+				Path:   strings.Split(rel, "/"),
+				Length: fi.Size(),
+			})
+		}
+	}
+
+	return info, nil
+}
+
+// 选择piece length并计算piece hash, 返回选择piece length的依据
+func hashInfoFromPath(filePath string, info *metainfo.Info, opts buildOptions) (string, error) {
+	var how string
+	info.PieceLength, how = choosePieceLength(opts.PieceLength, info.TotalLength())
+	err := generatePieces(info, func(fi metainfo.FileInfo) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(filePath, filepath.Join(fi.Path...)))
+	})
+	if err != nil {
+		return "", fmt.Errorf("error generating pieces: %w", err)
+	}
+	return how, nil
+}
+
+// 基于Info制作MetaInfo, 设置所有的字段
+func newMetaInfo(info *metainfo.Info) *metainfo.MetaInfo {
 	mi := metainfo.MetaInfo{}
 	mi.SetDefaults()
 	mi.InfoBytes = bencode.MustMarshal(info)
-	// tracker也应该是可以配置的,不应该固定
-	mi.Announce = Trackers[0][0]
-	mi.AnnounceList = Trackers
+	setTrackers(&mi, nil)
+	mi.UrlList = webSeedURLs(mi.HashInfoBytes())
+	return &mi
+}
 
-	return &mi, nil
+// 设置MetaInfo中的tracker, trackers为nil时使用configTrackers
+// 没有tracker时peer通过DHT/PEX以及IPList中的地址互相发现
+func setTrackers(mi *metainfo.MetaInfo, trackers [][]string) {
+	if trackers == nil {
+		trackers = configTrackers()
+	}
+	mi.Announce = ""
+	mi.AnnounceList = nil
+	if len(trackers) > 0 {
+		mi.Announce = trackers[0][0]
+		mi.AnnounceList = trackers
+	}
 }
 
-func infoBytesToInfo(infoBytes []byte) (*metainfo.Info, error) {
-	info := &metainfo.Info{}
-	err := bencode.Unmarshal(infoBytes, info)
+// config中的Torrent.Trackers, 没有配置时使用内置tracker或defaultTrackers
+func configTrackers() [][]string {
+	if optionsStruct == nil {
+		return defaultTrackers
+	}
+	if optionsStruct.Torrent.Trackers != nil {
+		return optionsStruct.Torrent.Trackers
+	}
+	if trackerEnabled() {
+		return [][]string{embeddedTrackerURLs()}
+	}
+	return defaultTrackers
+}
+
+// tracker分为多层(BEP 12), 每一层至少有一个地址
+func checkTrackers(trackers [][]string) error {
+	for i, tier := range trackers {
+		if len(tier) == 0 {
+			return fmt.Errorf("tracker tier %d is empty", i)
+		}
+		for _, tr := range tier {
+			u, err := url.Parse(tr)
+			if err != nil {
+				return fmt.Errorf("invalid tracker %q: %w", tr, err)
+			}
+			switch u.Scheme {
+			case "http", "https", "udp", "ws", "wss":
+			default:
+				return fmt.Errorf("invalid tracker %q: unsupported scheme %q", tr, u.Scheme)
+			}
+			if u.Host == "" {
+				return fmt.Errorf("invalid tracker %q: missing host", tr)
+			}
+		}
+	}
+	return nil
+}
+
+// disk与tmpfs一样基于文件路径制作torrent
+// 数据必须位于DataDir中, 否则torrentClient做种时找不到数据
+func fromDisk(filePath string, opts buildOptions) (*metainfo.MetaInfo, error) {
+	err := checkInStorageDir("disk", filePath)
 	if err != nil {
 		return nil, err
 	}
-	return info, nil
+	return fromPath(filePath, opts)
 }
 
-func seed(mi *metainfo.MetaInfo, mbp *storage.MemoryBuf) (err error) {
-	log.Printf("start seeding")
-	clientConfig := torrent.NewDefaultClientConfig()
-	clientConfig.Seed = true
-	clientConfig.Debug = *debugFlag
-
-	// 基于totalLength创建storage/client
-	// clientConfig.DefaultStorage
-	mbpp := &mbp
-	storageImplCloser, err := storage.NewMemory(mbp.Length, mbpp)
-	// storageImplCloser := storage.NewFile("./")
+// 检查文件(或多文件torrent的目录)是否直接位于存储目录中, tmpfs为ModelPath, disk为DataDir
+// storage按<存储目录>/<info.Name>查找数据, 子目录中的文件和存储目录本身都找不到
+func checkInStorageDir(method, filePath string) error {
+	dir := storageDir(method)
+	absDir, err := filepath.Abs(dir)
 	if err != nil {
-		return fmt.Errorf("NewMemory storage %w", err)
+		return err
+	}
+	absFilePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(absDir, absFilePath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s is not in %s storage dir %s", filePath, method, dir)
+	}
+	if filepath.Dir(absFilePath) != absDir {
+		return fmt.Errorf("%s must be directly in %s storage dir %s, not in a subdirectory", filePath, method, dir)
 	}
-	clientConfig.DefaultStorage = storageImplCloser
+	return nil
+}
 
-	client, err := torrent.NewClient(clientConfig)
+func infoBytesToInfo(infoBytes []byte) (*metainfo.Info, error) {
+	info := &metainfo.Info{}
+	err := bencode.Unmarshal(infoBytes, info)
 	if err != nil {
-		return fmt.Errorf("NewClient %w", err)
+		return nil, err
 	}
+	return info, nil
+}
 
-	// 向client中添加torrent
-	_, err = client.AddTorrent(mi)
+func seed(mi *metainfo.MetaInfo, mbp *storage.MemoryBuf) (err error) {
+	log.Printf("start seeding")
+	// 基于totalLength创建storage/client, 交给memoryManager管理
+	_, err = memoryTorrents.add(mi, mbp)
 	if err != nil {
-		return fmt.Errorf("AddTorrent: %w", err)
+		return fmt.Errorf("seed from memory: %w", err)
 	}
 	return
 }
 
 func seedFromTMPFS(mip *metainfo.MetaInfo) error {
+	return seedWithStorage(mip, "tmpfs")
+}
+
+// disk与tmpfs都由torrentClient管理, 只是storage不同
+func seedFromDisk(mip *metainfo.MetaInfo) error {
+	return seedWithStorage(mip, "disk")
+}
+
+func seedWithStorage(mip *metainfo.MetaInfo, method string) error {
 	// 1) create a client
 	// 2) add the MetaInfo to the client and return a torrent
 	// 3) when MetaInfo added, seeding starts
@@ -127,8 +333,18 @@ func seedFromTMPFS(mip *metainfo.MetaInfo) error {
 	// 	return fmt.Errorf("new torrent client: %w", err)
 	// }
 
+	// 数据必须位于存储目录中, 不能通过info.Name访问存储目录之外的文件
+	info, err := mip.UnmarshalInfo()
+	if err != nil {
+		return err
+	}
+	err = checkInStorageDir(method, torrentDataPath(method, mip.HashInfoBytes(), &info))
+	if err != nil {
+		return err
+	}
+
 	// add torrent
-	t, err := torrentClient.AddTorrent(mip)
+	t, _, err := addTorrent(mip, method)
 	if err != nil {
 		log.Printf("add torrent error: %v", err)
 		return err
@@ -143,7 +359,6 @@ func seedFromTMPFS(mip *metainfo.MetaInfo) error {
 		Files:       false,
 	})
 
-	info, err := mi.UnmarshalInfo()
 	log.Printf("info: %v", info.Describe())
 
 	path := fmt.Sprintf("./torrent/%s.torrent", info.BestName())
@@ -154,6 +369,12 @@ func seedFromTMPFS(mip *metainfo.MetaInfo) error {
 	} else {
 		log.Printf("wrote %q", path)
 	}
+	// layout为tensor时, tensor索引与.torrent文件保存在一起
+	indexPath := fmt.Sprintf("./torrent/%s.index.json", info.BestName())
+	err = writeTensorIndexToFile(mip.HashInfoBytes(), indexPath)
+	if err != nil {
+		log.Printf("error writing %q: %v", indexPath, err)
+	}
 
 	return nil
 
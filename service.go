@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// service层
+// http接口(旧接口和/v1/)与grpc控制面共用这里的实现, 两种传输方式的行为一致
+// 出错时返回带有状态码和错误码的apiError, http按状态码返回, grpc转换为对应的status code
+
+// 制作torrent, create_torrent/publish_model/v1共用
+// memory存储方式登记数据, 在start_seeding时创建client
+func createTorrent(input *createTorrentInput) (*metainfo.MetaInfo, error) {
+	method, err := parseStorageMethod(input.Storage)
+	if err == nil {
+		err = input.check(method)
+	}
+	if err != nil {
+		return nil, apiErrorf(http.StatusBadRequest, errCodeInvalidInput, "%v", err)
+	}
+
+	var mip *metainfo.MetaInfo
+	if input.Base != "" {
+		mip, err = createDelta(method, input)
+		if err != nil {
+			return nil, apiErrorf(http.StatusInternalServerError, errCodeInternal, "create delta from base %s: %v", input.Base, err)
+		}
+		return mip, nil
+	}
+	if input.Layout == layoutTensor {
+		mip, err = createTensorTorrent(method, input)
+		if err != nil {
+			return nil, apiErrorf(http.StatusInternalServerError, errCodeInternal, "create tensor layout torrent: %v", err)
+		}
+		return mip, nil
+	}
+	switch method {
+	case "memory":
+		if len(input.Mb.Data) == 0 {
+			return nil, apiErrorf(http.StatusBadRequest, errCodeInvalidInput, "create torrent from memory: empty data")
+		}
+		mip, err = fromMemory(input.Mb.Data, input.buildOptions())
+		if err == nil {
+			memoryTorrents.put(mip.HashInfoBytes(), &storage.MemoryBuf{
+				Data:   input.Mb.Data,
+				Length: int64(len(input.Mb.Data)),
+			})
+		}
+	case "tmpfs":
+		mip, err = fromTMPFS(input.Path, input.buildOptions())
+	case "disk":
+		mip, err = fromDisk(input.Path, input.buildOptions())
+	}
+	if err != nil {
+		return nil, apiErrorf(http.StatusInternalServerError, errCodeInternal, "create torrent from %s: %v", method, err)
+	}
+	setTorrentMethod(mip.HashInfoBytes(), method)
+	return mip, nil
+}
+
+// 开始做种, 返回torrent的状态
+func startSeeding(ctx context.Context, req *torrentRequest) (*getTorrentStatusOutput, error) {
+	// 存储方法: 请求中指定的, 或者create_torrent时使用的
+	method, err := torrentStorageMethod(req.ih, req.storage)
+	if err != nil {
+		return nil, apiErrorf(http.StatusBadRequest, errCodeInvalidStorage, "%v", err).on(req.ih)
+	}
+
+	// MetaInfo, 只有infohash时使用本地的torrent
+	mip, err := req.metaInfo(ctx, method, false)
+	if err != nil {
+		return nil, apiErrorf(http.StatusNotFound, errCodeTorrentNotFound, "%v", err).on(req.ih)
+	}
+	mi := *mip
+
+	// seeding
+	switch method {
+	case "memory":
+		_, _, err = addTorrent(&mi, method)
+	case "tmpfs":
+		err = seedFromTMPFS(&mi)
+	case "disk":
+		err = seedFromDisk(&mi)
+	}
+	if err != nil {
+		return nil, apiErrorf(http.StatusInternalServerError, errCodeInternal, "seed from %s: %v", method, err).on(req.ih)
+	}
+	log.Printf("seed %s from %s ok", req.ih.HexString(), method)
+	status := torrentStatus(req.ih)
+	return &status, nil
+}
+
+func torrentStatus(ih metainfo.Hash) getTorrentStatusOutput {
+	var status getTorrentStatusOutput
+	t, method, ok := findTorrent(ih)
+	status.Exist = ok
+	if ok {
+		status.Seeding = t.Seeding()
+		status.Storage = method
+	}
+	status.Swarm = trackerSwarmOf(ih)
+	return status
+}
+
+// 添加torrent并在后台下载, 返回下载任务
+func startDownloading(ctx context.Context, req *torrentRequest) (*startDownloadingOutput, error) {
+	// 存储方法: 请求中指定的, 或者默认值
+	method, err := torrentStorageMethod(req.ih, req.storage)
+	if err != nil {
+		return nil, apiErrorf(http.StatusBadRequest, errCodeInvalidStorage, "%v", err).on(req.ih)
+	}
+
+	// MetaInfo, 只有infohash时从本地或peer获取
+	mip, err := req.metaInfo(ctx, method, true)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, apiErrorf(http.StatusGatewayTimeout, errCodeMetainfoTimeout, "%v", err).on(req.ih)
+	}
+	if err != nil {
+		return nil, apiErrorf(http.StatusBadGateway, errCodeMetainfoUnavailable, "%v", err).on(req.ih)
+	}
+	mi := *mip
+
+	// Info
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return nil, apiErrorf(http.StatusBadRequest, errCodeInvalidInput, "unmarshal info bytes: %v", err).on(req.ih)
+	}
+
+	// 部分下载: 只下载覆盖请求的文件/范围的piece
+	output := downloadOutput(method, &mi, &info)
+	if req.sel != nil {
+		if isDeltaInfo(&info) {
+			err = fmt.Errorf("delta torrent must be downloaded completely")
+		} else {
+			err = selectPieces(req.sel, method, mi.HashInfoBytes(), &info, &output)
+		}
+	}
+	if err != nil {
+		return nil, apiErrorf(http.StatusBadRequest, errCodeInvalidInput, "%v", err).on(req.ih)
+	}
+
+	// 向client中添加torrent
+	t, cl, err := addTorrent(&mi, method)
+	if err != nil {
+		return nil, apiErrorf(http.StatusInternalServerError, errCodeInternal, "add torrent: %v", err).on(req.ih)
+	}
+	addPeers(t, req.peers, method)
+
+	// 在后台下载, 立即返回任务id
+	// delta torrent下载完成后应用到本地的base版本上
+	var onComplete func(*startDownloadingOutput) error
+	if isDeltaInfo(&info) {
+		onComplete = func(output *startDownloadingOutput) error {
+			return applyDelta(method, &mi, output)
+		}
+	}
+	job := downloadJobs.start(&mi, method, t, cl, output, onComplete)
+	output.JobID = job.id
+	return &output, nil
+}
+
+// 停止做种并卸载torrent, torrent不存在时返回false
+// - memory：client与torrent一对一, 卸载torrent的同时关闭client
+// - tmpfs/disk：由torrentClient统一管理, 直接卸载相应的torrent
+func stopSeeding(ih metainfo.Hash) bool {
+	if !dropTorrent(ih) {
+		return false
+	}
+	log.Printf("stop seeding %s ok", ih.HexString())
+	return true
+}
+
+// 推送下载进度, progress和grpc的WatchDownload共用
+// emit的event为piece(pieceEvent), stats/complete/dropped(statsEvent)
+// pieces中的piece(为nil时所有piece)下载完成、torrent被卸载或ctx结束时返回, emit出错时返回该错误
+func watchProgress(ctx context.Context, t *torrent.Torrent, ih metainfo.Hash, pieces [][2]int, interval time.Duration, emit func(event string, v interface{}) error) error {
+	select {
+	case <-t.GotInfo():
+	case <-t.Closed():
+		return nil
+	case <-ctx.Done():
+		return nil
+	}
+
+	// 先订阅再读取当前状态, 避免漏掉事件
+	sub := t.SubscribePieceStateChanges()
+	defer sub.Close()
+	if pieces == nil {
+		pieces = [][2]int{{0, t.NumPieces()}}
+	}
+	pending := make(map[int]struct{})
+	for _, r := range pieces {
+		for i := r[0]; i < r[1]; i++ {
+			if s := t.PieceState(i); !s.Complete || !s.Ok {
+				pending[i] = struct{}{}
+			}
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastStats := t.Stats()
+	lastTime := time.Now()
+	sendStats := func() error {
+		stats := t.Stats()
+		now := time.Now()
+		ev := newStatsEvent(t, ih)
+		ev.Rate = int64(float64(stats.BytesReadUsefulData.Int64()-lastStats.BytesReadUsefulData.Int64()) / now.Sub(lastTime).Seconds())
+		lastStats, lastTime = stats, now
+		return emit("stats", ev)
+	}
+	err := sendStats()
+	if err != nil {
+		return err
+	}
+
+	for {
+		if len(pending) == 0 {
+			log.Printf("progress %s complete", ih.HexString())
+			return emit("complete", newStatsEvent(t, ih))
+		}
+		select {
+		case v, ok := <-sub.Values:
+			if !ok {
+				return nil
+			}
+			if v.Complete && v.Ok {
+				delete(pending, v.Index)
+			}
+			err = emit("piece", pieceEvent{
+				Index:    v.Index,
+				Complete: v.Complete,
+				Ok:       v.Ok,
+				Partial:  v.Partial,
+				Checking: v.Checking,
+			})
+		case <-ticker.C:
+			err = sendStats()
+		case <-t.Closed():
+			return emit("dropped", newStatsEvent(t, ih))
+		case <-ctx.Done():
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// 每个请求可以选择自己的存储方法, config中的Storage.Method只是默认值
+// - memory：每个torrent一个client, 由memoryManager管理, 监听memoryPort(infohash)
+// - tmpfs/disk：共用torrentClient(只监听一个DataPort), 每个torrent使用对应的storage
+
+var storageMethods = []string{"memory", "tmpfs", "disk"}
+
+var storages map[string]storage.ClientImplCloser // tmpfs/disk对应的storage
+
+var torrentMethodsMu sync.Mutex
+var torrentMethods = make(map[metainfo.Hash]string) // torrent使用的存储方法
+
+// 创建所有存储方法需要的client/storage
+func initStorages(clientConfig *torrent.ClientConfig) (err error) {
+	memoryTorrents = newMemoryManager()
+
+	storages = make(map[string]storage.ClientImplCloser)
+	// 指定torrent data的存储路径
+	storages["tmpfs"] = storage.NewFile(configStruct.Model.ModelPath)
+	// 数据存储在DataDir, piece completion存储在PieceCompletionDir
+	storages["disk"], err = newDiskStorage(optionsStruct.Storage.DataDir, optionsStruct.Storage.PieceCompletionDir)
+	if err != nil {
+		return fmt.Errorf("create disk storage: %w", err)
+	}
+	// client通过BitTorrent回传的更新, 每个torrent一个目录, 避免同名文件互相覆盖
+	// 回传的数据读取后就会删除, 不需要持久化piece completion
+	err = os.MkdirAll(storageDir("upload"), 0o750)
+	if err != nil {
+		return fmt.Errorf("mkdir %s: %w", storageDir("upload"), err)
+	}
+	storages["upload"] = storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir: storageDir("upload"),
+		TorrentDirMaker: func(baseDir string, info *metainfo.Info, infoHash metainfo.Hash) string {
+			return filepath.Join(baseDir, infoHash.HexString())
+		},
+		PieceCompletion: storage.NewMapPieceCompletion(),
+	})
+	log.Printf("data dir for tmpfs %s, for disk %s, piece completion dir for disk %s, for uploads %s",
+		configStruct.Model.ModelPath, optionsStruct.Storage.DataDir, optionsStruct.Storage.PieceCompletionDir, storageDir("upload"))
+
+	// 没有指定storage的torrent使用默认存储方法的storage
+	if s, ok := storages[storageMethod]; ok {
+		clientConfig.DefaultStorage = s
+	} else {
+		clientConfig.DefaultStorage = storages["tmpfs"]
+	}
+	torrentClient, err = torrent.NewClient(clientConfig)
+	if err != nil {
+		return fmt.Errorf("create torrent.Client: %w", err)
+	}
+	return nil
+}
+
+// 检查存储方法, 为空时使用默认值
+func parseStorageMethod(method string) (string, error) {
+	method = strings.ToLower(method)
+	if method == "" {
+		return storageMethod, nil
+	}
+	for _, m := range storageMethods {
+		if m == method {
+			return method, nil
+		}
+	}
+	return "", fmt.Errorf("unknown storage method %q", method)
+}
+
+// bencode编码的torrent中可以额外携带storage字段, 解码MetaInfo时会被忽略
+func bdecodeStorageMethod(metaInfoBytes []byte) string {
+	var extra struct {
+		Storage string `bencode:"storage,omitempty"`
+	}
+	err := bencode.NewDecoder(bytes.NewBuffer(metaInfoBytes)).Decode(&extra)
+	if err != nil {
+		return ""
+	}
+	return extra.Storage
+}
+
+func setTorrentMethod(ih metainfo.Hash, method string) {
+	torrentMethodsMu.Lock()
+	defer torrentMethodsMu.Unlock()
+	torrentMethods[ih] = method
+}
+
+// torrent卸载后删除记录的存储方法, 之后tracker也不再接受它的announce
+func deleteTorrentMethod(ih metainfo.Hash) {
+	torrentMethodsMu.Lock()
+	defer torrentMethodsMu.Unlock()
+	delete(torrentMethods, ih)
+}
+
+// 确定torrent使用的存储方法
+// 请求中指定的 > create_torrent时记录的 > 默认值
+func torrentStorageMethod(ih metainfo.Hash, requested string) (string, error) {
+	if requested != "" {
+		return parseStorageMethod(requested)
+	}
+	torrentMethodsMu.Lock()
+	defer torrentMethodsMu.Unlock()
+	if method, ok := torrentMethods[ih]; ok {
+		return method, nil
+	}
+	return storageMethod, nil
+}
+
+// 存储方法对应的数据目录
+// upload是内部使用的存储方法, 位于默认存储方法的数据目录下
+func storageDir(method string) string {
+	if method == "disk" {
+		return optionsStruct.Storage.DataDir
+	}
+	if method == "upload" {
+		return filepath.Join(storageDir(storageMethod), "uploads")
+	}
+	return configStruct.Model.ModelPath
+}
+
+// torrent数据在本地的路径
+func torrentDataPath(method string, ih metainfo.Hash, info *metainfo.Info) string {
+	if method == "upload" {
+		return filepath.Join(storageDir(method), ih.HexString(), info.BestName())
+	}
+	return filepath.Join(storageDir(method), info.BestName())
+}
+
+// 按存储方法添加torrent, 返回torrent和管理它的client
+func addTorrent(mi *metainfo.MetaInfo, method string) (*torrent.Torrent, *torrent.Client, error) {
+	ih := mi.HashInfoBytes()
+	if method == "memory" {
+		mt, err := memoryTorrents.add(mi, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		setTorrentMethod(ih, method)
+		addBootstrapPeers(mt.t, method)
+		return mt.t, mt.client, nil
+	}
+
+	s, ok := storages[method]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown storage method %q", method)
+	}
+	if t, ok := torrentClient.Torrent(ih); ok {
+		// 已经添加过的torrent不能更换storage
+		if m, _ := torrentStorageMethod(ih, ""); m != method {
+			return nil, nil, fmt.Errorf("torrent %s already added with storage %s", ih.HexString(), m)
+		}
+		return t, torrentClient, nil
+	}
+	spec, err := torrent.TorrentSpecFromMetaInfoErr(mi)
+	if err != nil {
+		return nil, nil, err
+	}
+	spec.Storage = s
+	t, _, err := torrentClient.AddTorrentSpec(spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	setTorrentMethod(ih, method)
+	addBootstrapPeers(t, method)
+	return t, torrentClient, nil
+}
+
+// 在所有存储方法中查找torrent
+func findTorrent(ih metainfo.Hash) (*torrent.Torrent, string, bool) {
+	if mt, ok := memoryTorrents.get(ih); ok {
+		return mt.t, "memory", true
+	}
+	if t, ok := torrentClient.Torrent(ih); ok {
+		method, _ := torrentStorageMethod(ih, "")
+		return t, method, true
+	}
+	return nil, "", false
+}
+
+// 卸载torrent, memory存储方法同时关闭对应的client
+func dropTorrent(ih metainfo.Hash) bool {
+	defer deleteTorrentMethod(ih)
+	if memoryTorrents.drop(ih) {
+		return true
+	}
+	t, ok := torrentClient.Torrent(ih)
+	if !ok {
+		return false
+	}
+	t.Drop()
+	return true
+}
+
+// disk存储方式使用的storage
+// 数据存储在dataDir, piece completion存储在pieceCompletionDir(bolt/sqlite), 重启后不需要重新校验所有piece
+func newDiskStorage(dataDir, pieceCompletionDir string) (storage.ClientImplCloser, error) {
+	for _, dir := range []string{dataDir, pieceCompletionDir} {
+		err := os.MkdirAll(dir, 0o750)
+		if err != nil {
+			return nil, fmt.Errorf("mkdir %s: %w", dir, err)
+		}
+	}
+	pc, err := storage.NewDefaultPieceCompletionForDir(pieceCompletionDir)
+	if err != nil {
+		return nil, fmt.Errorf("new piece completion: %w", err)
+	}
+	return storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dataDir,
+		PieceCompletion: pc,
+	}), nil
+}
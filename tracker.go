@@ -0,0 +1,620 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// 内置tracker
+// server知道所有参与者, 不需要依赖外部的tracker(chihaya)
+// Tracker.Enabled时在Tracker.Port上同时监听http和udp(BEP 15):
+// - 只接受server自己制作或持有的torrent(create_torrent登记过的或client中的)的announce
+// - 没有配置Torrent.Trackers时, 制作的metainfo指向内置tracker
+// - swarm成员通过tracker_status和get_torrent_status获取
+// 超过两个announce间隔没有announce的peer被移除
+
+const (
+	defaultTrackerPort     = 6969
+	defaultTrackerInterval = 60
+	trackerDefaultNumWant  = 50
+	trackerMaxNumWant      = 200
+
+	udpTrackerProtocolID = 0x41727101980
+	udpConnectionTTL     = 2 * time.Minute
+)
+
+const (
+	udpActionConnect int32 = iota
+	udpActionAnnounce
+	udpActionScrape
+	udpActionError
+)
+
+type trackerPeer struct {
+	PeerID     string    `json:"peer_id"` // hex
+	Addr       string    `json:"addr"`
+	Uploaded   int64     `json:"uploaded"`
+	Downloaded int64     `json:"downloaded"`
+	Left       int64     `json:"left"`
+	Seeder     bool      `json:"seeder"`
+	LastSeen   time.Time `json:"last_seen"`
+	addrPort   netip.AddrPort
+	peerID     [20]byte // 原始的peer id, 非compact的http announce中返回
+}
+
+type trackerSwarm struct {
+	peers     map[string]*trackerPeer // key为peer id
+	completed int64                   // 完成下载(event=completed)的次数
+}
+
+type trackerSwarmStatus struct {
+	InfoHash  string         `json:"infohash"`
+	Seeders   int            `json:"seeders"`
+	Leechers  int            `json:"leechers"`
+	Completed int64          `json:"completed"`
+	Peers     []*trackerPeer `json:"peers"`
+}
+
+type trackerStatusOutput struct {
+	Enabled   bool                 `json:"enabled"`
+	Announce  []string             `json:"announce,omitempty"` // 写入metainfo的地址
+	Announces int64                `json:"announces"`
+	Rejected  int64                `json:"rejected"` // 不在registry中的infohash
+	Swarms    []trackerSwarmStatus `json:"swarms"`
+}
+
+// announce请求, http和udp共用
+type trackerAnnounce struct {
+	infoHash   metainfo.Hash
+	peerID     [20]byte
+	addrPort   netip.AddrPort
+	uploaded   int64
+	downloaded int64
+	left       int64
+	event      string // started/completed/stopped, 为空表示定期announce
+	numWant    int
+}
+
+type trackerAnnounceResult struct {
+	peers    []*trackerPeer
+	seeders  int
+	leechers int
+	interval int
+}
+
+type embeddedTracker struct {
+	mu        sync.Mutex
+	swarms    map[metainfo.Hash]*trackerSwarm
+	announces int64
+	rejected  int64
+
+	connMu sync.Mutex
+	conns  map[uint64]udpTrackerConn // udp的connection id
+}
+
+type udpTrackerConn struct {
+	addr    string
+	expires time.Time
+}
+
+var localTracker *embeddedTracker
+
+func trackerEnabled() bool {
+	return optionsStruct != nil && optionsStruct.Tracker.Enabled
+}
+
+func trackerInterval() int {
+	return optionsStruct.Tracker.Interval
+}
+
+// 内置tracker的地址, udp和http在同一层
+func embeddedTrackerURLs() []string {
+	host := optionsStruct.Tracker.Host
+	if host == "" && configStruct != nil {
+		host = configStruct.Server.ServerIP
+	}
+	hostPort := net.JoinHostPort(host, strconv.Itoa(optionsStruct.Tracker.Port))
+	return []string{
+		fmt.Sprintf("udp://%s/announce", hostPort),
+		fmt.Sprintf("http://%s/announce", hostPort),
+	}
+}
+
+// 只接受server自己制作或持有的torrent
+func trackerAuthorized(ih metainfo.Hash) bool {
+	torrentMethodsMu.Lock()
+	_, ok := torrentMethods[ih]
+	torrentMethodsMu.Unlock()
+	if ok {
+		return true
+	}
+	_, _, ok = findTorrent(ih)
+	return ok
+}
+
+func newEmbeddedTracker() *embeddedTracker {
+	return &embeddedTracker{
+		swarms: make(map[metainfo.Hash]*trackerSwarm),
+		conns:  make(map[uint64]udpTrackerConn),
+	}
+}
+
+// http tracker的announce和scrape
+func (tr *embeddedTracker) httpHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/announce", tr.serveHTTPAnnounce)
+	mux.HandleFunc("/scrape", tr.serveHTTPScrape)
+	return mux
+}
+
+func startTracker() error {
+	localTracker = newEmbeddedTracker()
+	addr := fmt.Sprintf(":%d", optionsStruct.Tracker.Port)
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("tracker listen udp %s: %w", addr, err)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		pc.Close()
+		return fmt.Errorf("tracker listen tcp %s: %w", addr, err)
+	}
+	go func() {
+		err := http.Serve(ln, localTracker.httpHandler())
+		log.Printf("tracker http server stopped: %v", err)
+	}()
+	go localTracker.serveUDP(pc)
+	log.Printf("embedded tracker listening on %s (http and udp), announce %v", addr, embeddedTrackerURLs())
+	return nil
+}
+
+func (tr *embeddedTracker) expireLocked(s *trackerSwarm, now time.Time) {
+	ttl := time.Duration(2*trackerInterval()+30) * time.Second
+	for id, p := range s.peers {
+		if now.Sub(p.LastSeen) > ttl {
+			delete(s.peers, id)
+		}
+	}
+}
+
+func (tr *embeddedTracker) announce(req trackerAnnounce) (*trackerAnnounceResult, error) {
+	if !trackerAuthorized(req.infoHash) {
+		tr.mu.Lock()
+		tr.rejected++
+		tr.mu.Unlock()
+		return nil, fmt.Errorf("unregistered torrent")
+	}
+	now := time.Now()
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.announces++
+	s, ok := tr.swarms[req.infoHash]
+	if !ok {
+		s = &trackerSwarm{peers: make(map[string]*trackerPeer)}
+		tr.swarms[req.infoHash] = s
+	}
+	tr.expireLocked(s, now)
+
+	id := hex.EncodeToString(req.peerID[:])
+	if req.event == "stopped" {
+		delete(s.peers, id)
+	} else {
+		s.peers[id] = &trackerPeer{
+			PeerID:     id,
+			Addr:       req.addrPort.String(),
+			Uploaded:   req.uploaded,
+			Downloaded: req.downloaded,
+			Left:       req.left,
+			Seeder:     req.left == 0,
+			LastSeen:   now,
+			addrPort:   req.addrPort,
+			peerID:     req.peerID,
+		}
+	}
+	if req.event == "completed" {
+		s.completed++
+	}
+
+	numWant := req.numWant
+	if numWant < 0 {
+		numWant = trackerDefaultNumWant
+	}
+	if numWant > trackerMaxNumWant {
+		numWant = trackerMaxNumWant
+	}
+	ret := &trackerAnnounceResult{interval: trackerInterval()}
+	for pid, p := range s.peers {
+		if p.Seeder {
+			ret.seeders++
+		} else {
+			ret.leechers++
+		}
+		// 不返回请求的peer自己, seeder之间不需要互相连接
+		if pid == id || len(ret.peers) >= numWant || (req.left == 0 && p.Seeder) {
+			continue
+		}
+		ret.peers = append(ret.peers, p)
+	}
+	return ret, nil
+}
+
+// 返回swarm的seeder/completed/leecher数量
+func (tr *embeddedTracker) scrape(ih metainfo.Hash) (seeders, completed, leechers int64) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	s, ok := tr.swarms[ih]
+	if !ok {
+		return
+	}
+	tr.expireLocked(s, time.Now())
+	for _, p := range s.peers {
+		if p.Seeder {
+			seeders++
+		} else {
+			leechers++
+		}
+	}
+	return seeders, s.completed, leechers
+}
+
+func (tr *embeddedTracker) swarmStatusLocked(ih metainfo.Hash, s *trackerSwarm) trackerSwarmStatus {
+	tr.expireLocked(s, time.Now())
+	ret := trackerSwarmStatus{
+		InfoHash:  ih.HexString(),
+		Completed: s.completed,
+		Peers:     []*trackerPeer{},
+	}
+	for _, p := range s.peers {
+		cp := *p
+		ret.Peers = append(ret.Peers, &cp)
+		if p.Seeder {
+			ret.Seeders++
+		} else {
+			ret.Leechers++
+		}
+	}
+	sort.Slice(ret.Peers, func(i, j int) bool { return ret.Peers[i].Addr < ret.Peers[j].Addr })
+	return ret
+}
+
+// 一个torrent的swarm, tracker没有开启或没有收到announce时返回nil
+func trackerSwarmOf(ih metainfo.Hash) *trackerSwarmStatus {
+	if localTracker == nil {
+		return nil
+	}
+	localTracker.mu.Lock()
+	defer localTracker.mu.Unlock()
+	s, ok := localTracker.swarms[ih]
+	if !ok {
+		return nil
+	}
+	status := localTracker.swarmStatusLocked(ih, s)
+	return &status
+}
+
+func (tr *embeddedTracker) status(filter *metainfo.Hash) trackerStatusOutput {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	ret := trackerStatusOutput{
+		Enabled:   true,
+		Announce:  embeddedTrackerURLs(),
+		Announces: tr.announces,
+		Rejected:  tr.rejected,
+		Swarms:    []trackerSwarmStatus{},
+	}
+	for ih, s := range tr.swarms {
+		if filter != nil && ih != *filter {
+			continue
+		}
+		ret.Swarms = append(ret.Swarms, tr.swarmStatusLocked(ih, s))
+	}
+	sort.Slice(ret.Swarms, func(i, j int) bool { return ret.Swarms[i].InfoHash < ret.Swarms[j].InfoHash })
+	return ret
+}
+
+// http tracker
+
+func writeTrackerFailure(w http.ResponseWriter, reason string) {
+	w.Write(bencode.MustMarshal(map[string]interface{}{"failure reason": reason}))
+}
+
+func queryHash20(r *http.Request, key string) ([20]byte, error) {
+	var ret [20]byte
+	v := r.URL.Query().Get(key)
+	if len(v) != 20 {
+		return ret, fmt.Errorf("invalid %s", key)
+	}
+	copy(ret[:], v)
+	return ret, nil
+}
+
+func remoteAddr(r *http.Request) (netip.Addr, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.Unmap(), nil
+}
+
+func (tr *embeddedTracker) serveHTTPAnnounce(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var req trackerAnnounce
+	ih, err := queryHash20(r, "info_hash")
+	if err == nil {
+		req.infoHash = metainfo.Hash(ih)
+		req.peerID, err = queryHash20(r, "peer_id")
+	}
+	var ip netip.Addr
+	if err == nil {
+		ip, err = remoteAddr(r)
+	}
+	var port uint64
+	if err == nil {
+		port, err = strconv.ParseUint(q.Get("port"), 10, 16)
+	}
+	if err != nil {
+		writeTrackerFailure(w, err.Error())
+		return
+	}
+	req.addrPort = netip.AddrPortFrom(ip, uint16(port))
+	req.uploaded, _ = strconv.ParseInt(q.Get("uploaded"), 10, 64)
+	req.downloaded, _ = strconv.ParseInt(q.Get("downloaded"), 10, 64)
+	req.left, err = strconv.ParseInt(q.Get("left"), 10, 64)
+	if err != nil {
+		req.left = -1
+	}
+	req.event = q.Get("event")
+	req.numWant = -1
+	if n, err := strconv.Atoi(q.Get("numwant")); err == nil {
+		req.numWant = n
+	}
+
+	result, err := tr.announce(req)
+	if err != nil {
+		log.Printf("tracker http announce %s from %s rejected: %v", req.infoHash.HexString(), r.RemoteAddr, err)
+		writeTrackerFailure(w, err.Error())
+		return
+	}
+	resp := map[string]interface{}{
+		"interval":     result.interval,
+		"min interval": result.interval / 2,
+		"complete":     result.seeders,
+		"incomplete":   result.leechers,
+	}
+	if q.Get("compact") == "0" {
+		var peers []map[string]interface{}
+		for _, p := range result.peers {
+			peers = append(peers, map[string]interface{}{
+				"peer id": string(p.peerID[:]), // BEP 3: 20字节的原始peer id
+				"ip":      p.addrPort.Addr().String(),
+				"port":    p.addrPort.Port(),
+			})
+		}
+		resp["peers"] = peers
+	} else {
+		var peers, peers6 []byte
+		for _, p := range result.peers {
+			if p.addrPort.Addr().Is4() {
+				peers = appendCompactPeer(peers, p.addrPort)
+			} else {
+				peers6 = appendCompactPeer(peers6, p.addrPort)
+			}
+		}
+		resp["peers"] = string(peers)
+		if len(peers6) > 0 {
+			resp["peers6"] = string(peers6)
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write(bencode.MustMarshal(resp))
+}
+
+func (tr *embeddedTracker) serveHTTPScrape(w http.ResponseWriter, r *http.Request) {
+	files := make(map[string]interface{})
+	for _, v := range r.URL.Query()["info_hash"] {
+		if len(v) != 20 {
+			writeTrackerFailure(w, "invalid info_hash")
+			return
+		}
+		var ih metainfo.Hash
+		copy(ih[:], v)
+		seeders, completed, leechers := tr.scrape(ih)
+		files[v] = map[string]interface{}{
+			"complete":   seeders,
+			"downloaded": completed,
+			"incomplete": leechers,
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write(bencode.MustMarshal(map[string]interface{}{"files": files}))
+}
+
+func appendCompactPeer(b []byte, addrPort netip.AddrPort) []byte {
+	b = append(b, addrPort.Addr().AsSlice()...)
+	return binary.BigEndian.AppendUint16(b, addrPort.Port())
+}
+
+// udp tracker(BEP 15)
+
+func (tr *embeddedTracker) serveUDP(pc net.PacketConn) {
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			log.Printf("tracker udp read error: %v", err)
+			return
+		}
+		resp := tr.handleUDP(buf[:n], addr)
+		if resp != nil {
+			_, err = pc.WriteTo(resp, addr)
+			if err != nil {
+				log.Printf("tracker udp write to %s error: %v", addr, err)
+			}
+		}
+	}
+}
+
+func udpTrackerError(tx int32, msg string) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, udpActionError)
+	binary.Write(&b, binary.BigEndian, tx)
+	b.WriteString(msg)
+	return b.Bytes()
+}
+
+func (tr *embeddedTracker) newConnectionID(addr net.Addr) uint64 {
+	var b [8]byte
+	rand.Read(b[:])
+	id := binary.BigEndian.Uint64(b[:])
+	now := time.Now()
+	tr.connMu.Lock()
+	defer tr.connMu.Unlock()
+	for k, c := range tr.conns {
+		if now.After(c.expires) {
+			delete(tr.conns, k)
+		}
+	}
+	tr.conns[id] = udpTrackerConn{addr: addr.String(), expires: now.Add(udpConnectionTTL)}
+	return id
+}
+
+func (tr *embeddedTracker) checkConnectionID(id uint64, addr net.Addr) bool {
+	tr.connMu.Lock()
+	defer tr.connMu.Unlock()
+	c, ok := tr.conns[id]
+	return ok && c.addr == addr.String() && time.Now().Before(c.expires)
+}
+
+var udpEvents = []string{"", "completed", "started", "stopped"}
+
+func (tr *embeddedTracker) handleUDP(data []byte, from net.Addr) []byte {
+	if len(data) < 16 {
+		return nil
+	}
+	connID := binary.BigEndian.Uint64(data[0:8])
+	action := int32(binary.BigEndian.Uint32(data[8:12]))
+	tx := int32(binary.BigEndian.Uint32(data[12:16]))
+	var b bytes.Buffer
+
+	if action == udpActionConnect {
+		if connID != udpTrackerProtocolID {
+			return nil
+		}
+		binary.Write(&b, binary.BigEndian, udpActionConnect)
+		binary.Write(&b, binary.BigEndian, tx)
+		binary.Write(&b, binary.BigEndian, tr.newConnectionID(from))
+		return b.Bytes()
+	}
+	if !tr.checkConnectionID(connID, from) {
+		return udpTrackerError(tx, "invalid connection id")
+	}
+	udpAddr, ok := from.(*net.UDPAddr)
+	if !ok {
+		return nil
+	}
+	ip := udpAddr.AddrPort().Addr().Unmap()
+
+	switch action {
+	case udpActionAnnounce:
+		// info_hash peer_id downloaded left uploaded event ip key num_want port
+		if len(data) < 98 {
+			return udpTrackerError(tx, "announce too short")
+		}
+		req := trackerAnnounce{
+			downloaded: int64(binary.BigEndian.Uint64(data[56:64])),
+			left:       int64(binary.BigEndian.Uint64(data[64:72])),
+			uploaded:   int64(binary.BigEndian.Uint64(data[72:80])),
+			numWant:    int(int32(binary.BigEndian.Uint32(data[92:96]))),
+		}
+		copy(req.infoHash[:], data[16:36])
+		copy(req.peerID[:], data[36:56])
+		if event := binary.BigEndian.Uint32(data[80:84]); int(event) < len(udpEvents) {
+			req.event = udpEvents[event]
+		}
+		req.addrPort = netip.AddrPortFrom(ip, binary.BigEndian.Uint16(data[96:98]))
+		result, err := tr.announce(req)
+		if err != nil {
+			log.Printf("tracker udp announce %s from %s rejected: %v", req.infoHash.HexString(), from, err)
+			return udpTrackerError(tx, err.Error())
+		}
+		binary.Write(&b, binary.BigEndian, udpActionAnnounce)
+		binary.Write(&b, binary.BigEndian, tx)
+		binary.Write(&b, binary.BigEndian, int32(result.interval))
+		binary.Write(&b, binary.BigEndian, int32(result.leechers))
+		binary.Write(&b, binary.BigEndian, int32(result.seeders))
+		// 通过ipv4请求时只返回ipv4的peer, ipv6同理
+		var peers []byte
+		for _, p := range result.peers {
+			if p.addrPort.Addr().Is4() == ip.Is4() {
+				peers = appendCompactPeer(peers, p.addrPort)
+			}
+		}
+		b.Write(peers)
+		return b.Bytes()
+	case udpActionScrape:
+		binary.Write(&b, binary.BigEndian, udpActionScrape)
+		binary.Write(&b, binary.BigEndian, tx)
+		for off := 16; off+20 <= len(data); off += 20 {
+			var ih metainfo.Hash
+			copy(ih[:], data[off:off+20])
+			seeders, completed, leechers := tr.scrape(ih)
+			binary.Write(&b, binary.BigEndian, int32(seeders))
+			binary.Write(&b, binary.BigEndian, int32(completed))
+			binary.Write(&b, binary.BigEndian, int32(leechers))
+		}
+		return b.Bytes()
+	}
+	return udpTrackerError(tx, "unknown action")
+}
+
+// 获取内置tracker的swarm
+// - 名称：tracker_status
+// - 输入：infohash(query, 可选, 为空时返回所有swarm)
+// - 方法：GET
+// - 输出：announce次数、拒绝次数和每个swarm的peer(json)
+
+func tracker_status(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
+	output := trackerStatusOutput{Swarms: []trackerSwarmStatus{}}
+	if localTracker != nil {
+		var filter *metainfo.Hash
+		if s := r.URL.Query().Get("infohash"); s != "" {
+			var ih metainfo.Hash
+			err := ih.FromHexString(s)
+			if err != nil {
+				log.Printf("tracker_status parse infohash error: %v", err)
+				http.Error(w, fmt.Sprintf("Invalid infohash: %v", err), http.StatusBadRequest)
+				return
+			}
+			filter = &ih
+		}
+		output = localTracker.status(filter)
+	}
+	data, err := json.Marshal(output)
+	if err != nil {
+		log.Printf("tracker_status json marshal error: %v", err)
+		http.Error(w, "Json marshal tracker status failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
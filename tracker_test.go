@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// peer id不是合法的utf-8, 非compact的响应中必须是原始的20字节
+var (
+	testLeecherID = [20]byte{'-', 'L', 'E', '0', '0', '0', '1', '-', 0xff, 0xfe, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	testSeederID  = [20]byte{'-', 'S', 'E', '0', '0', '0', '1', '-', 0x80, 0x81, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+)
+
+func newTestTracker(t *testing.T) (*embeddedTracker, metainfo.Hash) {
+	ih := metainfo.HashBytes([]byte(t.Name()))
+	setTorrentMethod(ih, "tmpfs")
+	t.Cleanup(func() { deleteTorrentMethod(ih) })
+	return newEmbeddedTracker(), ih
+}
+
+func httpAnnounce(t *testing.T, base string, ih metainfo.Hash, peerID [20]byte, port int, left int64, compact string) map[string]interface{} {
+	q := url.Values{
+		"info_hash": {string(ih[:])},
+		"peer_id":   {string(peerID[:])},
+		"port":      {strconv.Itoa(port)},
+		"left":      {strconv.FormatInt(left, 10)},
+		"compact":   {compact},
+	}
+	resp, err := http.Get(base + "/announce?" + q.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var ret map[string]interface{}
+	err = bencode.NewDecoder(resp.Body).Decode(&ret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason, ok := ret["failure reason"]; ok {
+		t.Fatalf("announce failure: %v", reason)
+	}
+	return ret
+}
+
+func TestHTTPTracker(t *testing.T) {
+	tr, ih := newTestTracker(t)
+	srv := httptest.NewServer(tr.httpHandler())
+	defer srv.Close()
+
+	httpAnnounce(t, srv.URL, ih, testLeecherID, 1111, 100, "0")
+	resp := httpAnnounce(t, srv.URL, ih, testSeederID, 2222, 0, "0")
+	if resp["complete"] != int64(1) || resp["incomplete"] != int64(1) {
+		t.Errorf("announce %v", resp)
+	}
+	peers, ok := resp["peers"].([]interface{})
+	if !ok || len(peers) != 1 {
+		t.Fatalf("peers %#v", resp["peers"])
+	}
+	peer := peers[0].(map[string]interface{})
+	if peer["peer id"] != string(testLeecherID[:]) || peer["ip"] != "127.0.0.1" || peer["port"] != int64(1111) {
+		t.Errorf("peer %q", peer)
+	}
+
+	// compact: 每个peer 6字节
+	resp = httpAnnounce(t, srv.URL, ih, testSeederID, 2222, 0, "1")
+	compact, _ := resp["peers"].(string)
+	if len(compact) != 6 || net.IP(compact[:4]).String() != "127.0.0.1" || binary.BigEndian.Uint16([]byte(compact[4:])) != 1111 {
+		t.Errorf("compact peers %q", compact)
+	}
+
+	// 只接受登记过的torrent
+	unknown := metainfo.HashBytes([]byte("unknown"))
+	q := url.Values{"info_hash": {string(unknown[:])}, "peer_id": {string(testLeecherID[:])}, "port": {"1"}}
+	r, err := http.Get(srv.URL + "/announce?" + q.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var failure map[string]interface{}
+	err = bencode.NewDecoder(r.Body).Decode(&failure)
+	r.Body.Close()
+	if err != nil || failure["failure reason"] == nil {
+		t.Errorf("unknown torrent announce %v, %v", failure, err)
+	}
+
+	r, err = http.Get(srv.URL + "/scrape?" + url.Values{"info_hash": {string(ih[:])}}.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	var scrape struct {
+		Files map[string]struct {
+			Complete   int64 `bencode:"complete"`
+			Downloaded int64 `bencode:"downloaded"`
+			Incomplete int64 `bencode:"incomplete"`
+		} `bencode:"files"`
+	}
+	err = bencode.NewDecoder(r.Body).Decode(&scrape)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, ok := scrape.Files[string(ih[:])]
+	if !ok || f.Complete != 1 || f.Incomplete != 1 {
+		t.Errorf("scrape %+v", scrape)
+	}
+}
+
+// 发送udp请求并读取响应, 检查action和transaction id
+func udpRoundTrip(t *testing.T, conn net.Conn, req []byte, action int32) []byte {
+	_, err := conn.Write(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 2048)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := buf[:n]
+	if len(resp) < 8 {
+		t.Fatalf("udp response too short: %x", resp)
+	}
+	if got := int32(binary.BigEndian.Uint32(resp[0:4])); got != action {
+		t.Fatalf("udp action %d, want %d: %q", got, action, resp[8:])
+	}
+	if !bytes.Equal(resp[4:8], req[12:16]) {
+		t.Fatalf("udp transaction id %x, want %x", resp[4:8], req[12:16])
+	}
+	return resp[8:]
+}
+
+func udpRequest(connID uint64, action int32, tx int32, body []byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, connID)
+	binary.Write(&b, binary.BigEndian, action)
+	binary.Write(&b, binary.BigEndian, tx)
+	b.Write(body)
+	return b.Bytes()
+}
+
+func TestUDPTracker(t *testing.T) {
+	tr, ih := newTestTracker(t)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go tr.serveUDP(pc)
+
+	announce := func(peerID [20]byte, port uint16, left int64) (interval, leechers, seeders int32, peers []byte) {
+		conn, err := net.Dial("udp", pc.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		resp := udpRoundTrip(t, conn, udpRequest(udpTrackerProtocolID, udpActionConnect, 1, nil), udpActionConnect)
+		connID := binary.BigEndian.Uint64(resp)
+
+		// info_hash peer_id downloaded left uploaded event ip key num_want port
+		var b bytes.Buffer
+		b.Write(ih[:])
+		b.Write(peerID[:])
+		binary.Write(&b, binary.BigEndian, int64(0))
+		binary.Write(&b, binary.BigEndian, left)
+		binary.Write(&b, binary.BigEndian, int64(0))
+		binary.Write(&b, binary.BigEndian, uint32(2)) // started
+		binary.Write(&b, binary.BigEndian, uint32(0))
+		binary.Write(&b, binary.BigEndian, uint32(0))
+		binary.Write(&b, binary.BigEndian, int32(-1))
+		binary.Write(&b, binary.BigEndian, port)
+		resp = udpRoundTrip(t, conn, udpRequest(connID, udpActionAnnounce, 2, b.Bytes()), udpActionAnnounce)
+		if len(resp) < 12 {
+			t.Fatalf("announce response too short: %x", resp)
+		}
+		return int32(binary.BigEndian.Uint32(resp[0:4])), int32(binary.BigEndian.Uint32(resp[4:8])), int32(binary.BigEndian.Uint32(resp[8:12])), resp[12:]
+	}
+
+	announce(testLeecherID, 1111, 100)
+	interval, leechers, seeders, peers := announce(testSeederID, 2222, 0)
+	if interval != int32(trackerInterval()) || leechers != 1 || seeders != 1 {
+		t.Errorf("announce interval %d, leechers %d, seeders %d", interval, leechers, seeders)
+	}
+	if len(peers) != 6 || net.IP(peers[:4]).String() != "127.0.0.1" || binary.BigEndian.Uint16(peers[4:]) != 1111 {
+		t.Errorf("announce peers %x", peers)
+	}
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// 没有connect时connection id无效
+	resp := udpRoundTrip(t, conn, udpRequest(12345, udpActionScrape, 3, ih[:]), udpActionError)
+	if len(resp) == 0 {
+		t.Errorf("empty error message")
+	}
+	resp = udpRoundTrip(t, conn, udpRequest(udpTrackerProtocolID, udpActionConnect, 4, nil), udpActionConnect)
+	connID := binary.BigEndian.Uint64(resp)
+	resp = udpRoundTrip(t, conn, udpRequest(connID, udpActionScrape, 5, ih[:]), udpActionScrape)
+	if len(resp) != 12 {
+		t.Fatalf("scrape response %x", resp)
+	}
+	if s, c, l := binary.BigEndian.Uint32(resp[0:4]), binary.BigEndian.Uint32(resp[4:8]), binary.BigEndian.Uint32(resp[8:12]); s != 1 || c != 0 || l != 1 {
+		t.Errorf("scrape seeders %d, completed %d, leechers %d", s, c, l)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// client通过BitTorrent回传更新, 避免所有数据都经过server的上行链路
+// 1) client在自己的节点上create_torrent + start_seeding
+// 2) client把torrent发送到/recv_torrent/
+// 3) server下载该torrent, 完成后记录到当前轮次, 与/recv/相同
+
+// - 名称：recv_torrent
+// - 输入：torrent, client/round/samples(query, 与/recv/相同), X-Client-Id
+// - 方法：POST
+// - 输出：下载任务id, 可以通过get_job/wait_job查询, 本地已经有该torrent或者正在回传时返回409
+
+// 正在回传的torrent, 任务结束后卸载torrent并删除数据
+var (
+	uploadsMu sync.Mutex
+	uploads   = make(map[metainfo.Hash]bool)
+)
+
+// 登记回传的torrent
+// 本地已经有该torrent(比如server自己做种的模型)或者已经在回传时返回false, 不能在回传结束后卸载它
+func reserveUpload(ih metainfo.Hash) bool {
+	uploadsMu.Lock()
+	defer uploadsMu.Unlock()
+	if uploads[ih] {
+		return false
+	}
+	if _, _, ok := findTorrent(ih); ok {
+		return false
+	}
+	uploads[ih] = true
+	return true
+}
+
+func releaseUpload(ih metainfo.Hash) {
+	uploadsMu.Lock()
+	defer uploadsMu.Unlock()
+	delete(uploads, ih)
+}
+
+func recv_torrent(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
+	if r.Method != "POST" {
+		log.Printf("Invalid request method %s", r.Method)
+		http.Error(w, fmt.Sprintf("Invalid request method %s", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 在接收数据之前检查轮次, 避免下载不需要的数据
+	client, number, err := roundRequest(r)
+	if err != nil {
+		writeRoundError(w, err)
+		return
+	}
+	samples := r.URL.Query().Get("samples")
+
+	// read data
+	metaInfoBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("recv_torrent read data error: %v", err)
+		http.Error(w, "Read data failed", http.StatusInternalServerError)
+		return
+	}
+
+	// MetaInfo
+	var mi metainfo.MetaInfo
+	d := bencode.NewDecoder(bytes.NewBuffer(metaInfoBytes))
+	err = d.Decode(&mi)
+	if err != nil {
+		log.Printf("recv_torrent bdecode torrent error: %v", err)
+		http.Error(w, "Bdecode torrent failed", http.StatusBadRequest)
+		return
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		log.Printf("recv_torrent unmarshal info bytes error: %v", err)
+		http.Error(w, "Unmarshal info bytes failed", http.StatusBadRequest)
+		return
+	}
+	if info.IsDir() {
+		http.Error(w, "Update torrent must contain a single file", http.StatusBadRequest)
+		return
+	}
+
+	ih := mi.HashInfoBytes()
+	if !reserveUpload(ih) {
+		log.Printf("recv_torrent from %s: torrent %s already exists", r.RemoteAddr, ih.HexString())
+		http.Error(w, fmt.Sprintf("Torrent %s already exists", ih.HexString()), http.StatusConflict)
+		return
+	}
+
+	// 没有指定round时使用当前轮次, 下载很慢时也不会记录到之后的轮次
+	number, err = rounds.uploading(client, number, ih)
+	if err != nil {
+		releaseUpload(ih)
+		log.Printf("recv_torrent from %s error: %v", r.RemoteAddr, err)
+		writeRoundError(w, err)
+		return
+	}
+	setClientIDHeader(w, client)
+
+	// memory存储方法下直接保存在内存中, 否则保存在每个torrent单独的目录中
+	method := "upload"
+	if storageMethod == "memory" {
+		method = "memory"
+	}
+	t, cl, err := addTorrent(&mi, method)
+	if err != nil {
+		releaseUpload(ih)
+		log.Printf("recv_torrent add torrent error: %v", err)
+		http.Error(w, "recv_torrent add torrent failed", http.StatusInternalServerError)
+		return
+	}
+
+	output := downloadOutput(method, &mi, &info)
+	job := downloadJobs.start(&mi, method, t, cl, output, func(output *startDownloadingOutput) error {
+		return recvUploaded(client, number, *output, samples)
+	})
+	// 任务结束后(完成、失败或取消)卸载torrent并删除数据
+	go func() {
+		<-job.done
+		dropTorrent(ih)
+		if output.Path != "" {
+			os.RemoveAll(filepath.Dir(output.Path))
+		}
+		releaseUpload(ih)
+	}()
+	output.JobID = job.id
+	outputJson, err := json.Marshal(output)
+	if err != nil {
+		log.Printf("recv_torrent json marshal error: %v", err)
+		http.Error(w, "Json marshal recv_torrent output failed", http.StatusInternalServerError)
+		return
+	}
+	w.Write(outputJson)
+	log.Printf("recv_torrent from %s: job %s for %s", client.key, job.id, ih.HexString())
+}
+
+// 下载完成后读取数据, 记录到轮次中
+func recvUploaded(client *roundClient, number int, output startDownloadingOutput, samples string) error {
+	var data []byte
+	if output.Path != "" {
+		var err error
+		data, err = os.ReadFile(output.Path)
+		if err != nil {
+			return err
+		}
+	} else {
+		data = output.Mb.Data
+	}
+	u, err := parseRoundUpdate(data, samples)
+	if err != nil {
+		return fmt.Errorf("parse update: %w", err)
+	}
+	return rounds.recv(client, number, len(data), u)
+}
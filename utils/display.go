@@ -13,27 +13,35 @@ import (
 	"github.com/dustin/go-humanize"
 )
 
-func TorrentBar(t *torrent.Torrent, pieceStates bool) {
+// 定时打印下载进度, ctx结束或torrent被卸载后退出
+func TorrentBar(ctx context.Context, t *torrent.Torrent, pieceStates bool) {
 	go func() {
 		start := time.Now()
 		if t.Info() == nil {
 			log.Printf("%v: getting torrent info for %q\n", time.Since(start), t.Name())
-			<-t.GotInfo()
+			select {
+			case <-t.GotInfo():
+			case <-t.Closed():
+				return
+			case <-ctx.Done():
+				return
+			}
 		}
 		lastStats := t.Stats()
 		var lastLine string
 		interval := 3 * time.Second
-		for range time.Tick(interval) {
-			var completedPieces, partialPieces int
-			psrs := t.PieceStateRuns()
-			for _, r := range psrs {
-				if r.Complete {
-					completedPieces += r.Length
-				}
-				if r.Partial {
-					partialPieces += r.Length
-				}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-t.Closed():
+				return
+			case <-ctx.Done():
+				return
 			}
+			psrs := t.PieceStateRuns()
+			completedPieces, partialPieces := CountPieces(psrs)
 			stats := t.Stats()
 			byteRate := int64(time.Second)
 			byteRate *= stats.BytesReadUsefulData.Int64() - lastStats.BytesReadUsefulData.Int64()
@@ -62,6 +70,19 @@ func TorrentBar(t *torrent.Torrent, pieceStates bool) {
 	}()
 }
 
+// 统计已完成和部分完成的piece数量
+func CountPieces(psrs torrent.PieceStateRuns) (completedPieces, partialPieces int) {
+	for _, r := range psrs {
+		if r.Complete {
+			completedPieces += r.Length
+		}
+		if r.Partial {
+			partialPieces += r.Length
+		}
+	}
+	return
+}
+
 func WaitForPieces(ctx context.Context, t *torrent.Torrent, beginIndex, endIndex int) {
 	sub := t.SubscribePieceStateChanges()
 	defer sub.Close()
@@ -82,7 +103,11 @@ func WaitForPieces(ctx context.Context, t *torrent.Torrent, beginIndex, endIndex
 		}
 		select {
 		// ev.Index这个piece被下载
-		case ev := <-sub.Values:
+		case ev, ok := <-sub.Values:
+			if !ok {
+				// torrent被卸载
+				return
+			}
 			if ev.Completion == expected {
 				delete(pending, ev.Index) // delete from the map by key
 			}
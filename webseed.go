@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// http web seed(BEP 19)
+// server持有完整的数据, swarm中的peer很慢或者没有peer时, client可以直接从server下载缺少的piece
+// Torrent.WebSeed打开时, 制作的metainfo的UrlList中写入http(s)://<host>:<HttpPort>/webseed/<infohash>/,
+// torrent库按BEP 19在后面加上<name>(多文件torrent为<name>/<path>), 通过range请求读取
+// 只提供server持有完整数据的torrent, 下载中的torrent返回404
+
+const webSeedPrefix = "/webseed/"
+
+// torrent的web seed地址, 没有开启时返回nil
+func webSeedURLs(ih metainfo.Hash) []string {
+	if optionsStruct == nil || !optionsStruct.Torrent.WebSeed || configStruct == nil {
+		return nil
+	}
+	host := optionsStruct.Torrent.WebSeedHost
+	if host == "" {
+		host = configStruct.Server.ServerIP
+	}
+	scheme := "http"
+	if serverTLS != nil {
+		scheme = "https"
+	}
+	hostPort := net.JoinHostPort(host, strconv.Itoa(configStruct.Port.HTTPPort))
+	return []string{fmt.Sprintf("%s://%s%s%s/", scheme, hostPort, webSeedPrefix, ih.HexString())}
+}
+
+// 按BEP 19的路径查找torrent中的文件, 返回文件的内容
+func openWebSeedFile(ih metainfo.Hash, path string) (io.ReadSeeker, time.Time, error) {
+	mip := localMetaInfo(ih)
+	if mip == nil {
+		return nil, time.Time{}, os.ErrNotExist
+	}
+	info, err := mip.UnmarshalInfo()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	// 下载中的torrent数据不完整
+	if t, _, ok := findTorrent(ih); ok && t.Info() != nil && t.BytesMissing() != 0 {
+		return nil, time.Time{}, os.ErrNotExist
+	}
+	method, _ := torrentStorageMethod(ih, "")
+	for _, f := range infoFiles(method, ih, &info) {
+		name := info.Name
+		if info.IsDir() {
+			name += "/" + f.Path
+		}
+		if name != path {
+			continue
+		}
+		if method == "memory" {
+			mt, ok := memoryTorrents.lookup(ih)
+			if !ok || int64(len(mt.mb.Data)) < f.Offset+f.Length {
+				return nil, time.Time{}, os.ErrNotExist
+			}
+			return bytes.NewReader(mt.mb.Data[f.Offset : f.Offset+f.Length]), time.Time{}, nil
+		}
+		fi, err := os.Stat(f.Local)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if fi.Size() != f.Length {
+			return nil, time.Time{}, fmt.Errorf("%s size %d, expected %d", f.Local, fi.Size(), f.Length)
+		}
+		file, err := os.Open(f.Local)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		return file, fi.ModTime(), nil
+	}
+	return nil, time.Time{}, os.ErrNotExist
+}
+
+// 通过http提供torrent中的文件
+// - 名称：webseed
+// - 输入：/webseed/<infohash>/<name>[/<path>], Range头
+// - 方法：GET/HEAD
+// - 输出：文件内容(支持range请求)
+
+func webseed(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s from %s, range %q", r.Method, r.RequestURI, r.RemoteAddr, r.Header.Get("Range"))
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, fmt.Sprintf("Invalid request method %s", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, webSeedPrefix)
+	ihHex, path, _ := strings.Cut(rest, "/")
+	var ih metainfo.Hash
+	err := ih.FromHexString(ihHex)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid infohash: %v", err), http.StatusBadRequest)
+		return
+	}
+	content, modTime, err := openWebSeedFile(ih, path)
+	if os.IsNotExist(err) {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("webseed %s/%s error: %v", ihHex, path, err)
+		http.Error(w, "Open file failed", http.StatusInternalServerError)
+		return
+	}
+	if c, ok := content.(io.Closer); ok {
+		defer c.Close()
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "", modTime, content)
+}